@@ -0,0 +1,17 @@
+package client
+
+import "net/http"
+
+// Credentials authenticate requests with an API token or the admin password
+type Credentials struct {
+	Token    string
+	Password string
+}
+
+func (c Credentials) apply(req *http.Request) {
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	} else if c.Password != "" {
+		req.Header.Set("Password", c.Password)
+	}
+}
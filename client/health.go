@@ -0,0 +1,41 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Ready asks the server whether it is ready, the error lists the checks of the
+// server which failed
+func Ready(address string) error {
+	req, err := http.NewRequest("GET", address+"/readyz", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var m struct {
+		Checks map[string]string `json:"checks"`
+	}
+	json.NewDecoder(resp.Body).Decode(&m)
+	var failed []string
+	for name, result := range m.Checks {
+		if result != "ok" {
+			failed = append(failed, name+": "+result)
+		}
+	}
+	sort.Strings(failed)
+	return fmt.Errorf("server not ready (%d): %s", resp.StatusCode, strings.Join(failed, ", "))
+}
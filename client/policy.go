@@ -0,0 +1,42 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+func SetMandatory(component, channel, Os, arch, version, address string, creds Credentials, mandatory bool) error {
+	req, err := http.NewRequest("PUT", fmt.Sprintf("%s/api/%s/%s/%s/%s/%s/mandatory", address, component, channel, Os, arch, version), nil)
+	if err != nil {
+		return err
+	}
+
+	creds.apply(req)
+	req.Header.Set("Mandatory", strconv.FormatBool(mandatory))
+
+	return sendRequest(req, 200)
+}
+
+func SetMinimumVersion(component, channel, version, address string, creds Credentials) error {
+	req, err := http.NewRequest("PUT", fmt.Sprintf("%s/api/%s/%s/minversion", address, component, channel), nil)
+	if err != nil {
+		return err
+	}
+
+	creds.apply(req)
+	req.Header.Set("Version", version)
+
+	return sendRequest(req, 200)
+}
+
+func ClearMinimumVersion(component, channel, address string, creds Credentials) error {
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/api/%s/%s/minversion", address, component, channel), nil)
+	if err != nil {
+		return err
+	}
+
+	creds.apply(req)
+
+	return sendRequest(req, 200)
+}
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+var httpClient = &http.Client{}
+
+// UseTLS configures the client certificate presented to the server and the CA
+// verifying the server, empty files keep the defaults
+func UseTLS(certFile, keyFile, caFile string) error {
+	conf := &tls.Config{}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return err
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return err
+		}
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM(pem) {
+			return errors.New("no certificates found in " + caFile)
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = conf
+	httpClient = &http.Client{Transport: transport}
+	return nil
+}
+
+func sendRequest(req *http.Request, expectedStatus int) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != expectedStatus {
+		var m map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&m)
+		return fmt.Errorf("server response error: %s", m["error"])
+	}
+
+	return nil
+}
@@ -0,0 +1,19 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+func SetRollout(component, channel, Os, arch, version, address string, creds Credentials, rollout int) error {
+	req, err := http.NewRequest("PUT", fmt.Sprintf("%s/api/%s/%s/%s/%s/%s/rollout", address, component, channel, Os, arch, version), nil)
+	if err != nil {
+		return err
+	}
+
+	creds.apply(req)
+	req.Header.Set("Rollout", strconv.Itoa(rollout))
+
+	return sendRequest(req, 200)
+}
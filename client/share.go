@@ -0,0 +1,38 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ShareBinary returns a signed link to download a binary without credentials,
+// bound to ip if it isn't empty
+func ShareBinary(component, channel, Os, arch, version, address string, creds Credentials, expiry time.Duration, ip string) (string, error) {
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/api/%s/%s/%s/%s/%s/share", address, component, channel, Os, arch, version), nil)
+	if err != nil {
+		return "", err
+	}
+
+	creds.apply(req)
+	req.Header.Set("Expires-In", expiry.String())
+	if ip != "" {
+		req.Header.Set("Bind-Ip", ip)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var m map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&m)
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("server response error: %s", m["error"])
+	}
+
+	url, _ := m["url"].(string)
+	return address + url, nil
+}
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 
 	"wpkg.dev/wpkgup/crypto"
 	"wpkg.dev/wpkgup/utils"
@@ -60,11 +61,14 @@ func generateSign(privateKey *ecdsa.PrivateKey, filename, output string) error {
 	return os.WriteFile(output, signBuffer, 0664)
 }
 
-func UploadBinary(component, channel, Os, arch, version, address, filename string, privateKey *ecdsa.PrivateKey) error {
+// UploadBinary uploads and publishes a binary, an already published version is
+// only replaced with overwrite and admin credentials
+func UploadBinary(component, channel, Os, arch, version, address, filename string, rollout int, overwrite bool, creds Credentials, privateKey *ecdsa.PrivateKey) error {
 	temp, err := os.MkdirTemp("", "wpkgup2_*")
 	if err != nil {
 		return fmt.Errorf("mkdir temp error: %s", err)
 	}
+	defer os.RemoveAll(temp)
 
 	var requestBody bytes.Buffer
 	writer := multipart.NewWriter(&requestBody)
@@ -78,6 +82,13 @@ func UploadBinary(component, channel, Os, arch, version, address, filename strin
 	//adding file
 	addToForm(writer, "file", filename)
 	addToForm(writer, "sign", signPath)
+	writer.WriteField("rollout", strconv.Itoa(rollout))
+
+	keyId, err := crypto.Fingerprint(crypto.GeneratePublicFromPrivate(privateKey))
+	if err != nil {
+		return fmt.Errorf("key id error: %s", err)
+	}
+	writer.WriteField("key_id", keyId)
 
 	writer.Close()
 
@@ -94,10 +105,15 @@ func UploadBinary(component, channel, Os, arch, version, address, filename strin
 		return fmt.Errorf("http error: %s", err)
 	}
 
+	//the server reserves quota for the announced size
+	request.ContentLength = int64(requestBody.Len())
 	request.Header.Set("Content-Type", writer.FormDataContentType())
+	if overwrite {
+		request.Header.Set("Overwrite", "true")
+	}
+	creds.apply(request)
 
-	client := &http.Client{}
-	resp, err := client.Do(request)
+	resp, err := httpClient.Do(request)
 	if err != nil {
 
 		return fmt.Errorf("http request error: %s", err)
@@ -110,6 +126,9 @@ func UploadBinary(component, channel, Os, arch, version, address, filename strin
 	if resp.StatusCode != 201 {
 		var m map[string]interface{}
 		json.NewDecoder(resp.Body).Decode(&m)
+		if message, ok := m["message"]; ok {
+			return fmt.Errorf("server response error: %s: %s", m["error"], message)
+		}
 		return fmt.Errorf("server response error: %s", m["error"])
 	}
 
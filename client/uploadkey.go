@@ -10,7 +10,7 @@ import (
 	"wpkg.dev/wpkgup/crypto"
 )
 
-func UploadKey(address, password string) error {
+func UploadKey(address string, creds Credentials) error {
 	req, err := http.NewRequest("PUT", fmt.Sprintf("%s/api/keys/add", address), nil)
 	if err != nil {
 		return err
@@ -25,11 +25,10 @@ func UploadKey(address, password string) error {
 		return err
 	}
 
-	req.Header.Set("Password", password)
+	creds.apply(req)
 	req.Header.Set("Key", privateKeyString)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return err
 	}
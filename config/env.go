@@ -0,0 +1,153 @@
+package config
+
+import (
+	"encoding"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// EnvPrefix prefixes the environment variables overriding config options
+const EnvPrefix = "WPKGUP_"
+
+// ApplyEnv replaces options with environment variables named after their path
+// in the config, like WPKGUP_SERVER_LISTEN or WPKGUP_STORAGE_S3_BUCKET. Lists
+// are comma separated. Maps like Channels are TOML tables whose entries
+// replace the entries of the same key in the config file, like
+// WPKGUP_CHANNELS='"app/beta" = { Private = true }'. WPKGUP_PASSWORD sets the
+// admin password.
+func (c *Config) ApplyEnv() error {
+	err := applyEnv(reflect.ValueOf(c).Elem(), EnvPrefix)
+	if err != nil {
+		return err
+	}
+
+	//hashed like a plain text password of the file when the config is loaded
+	password, ok, err := LookupEnv(EnvPrefix + "PASSWORD")
+	if ok {
+		c.Password = password
+	}
+	return err
+}
+
+// LookupEnv returns the value of an environment variable, or the content of
+// the file named by the variable with a _FILE suffix, as used by Docker secrets
+func LookupEnv(name string) (string, bool, error) {
+	if value, ok := os.LookupEnv(name); ok {
+		return value, true, nil
+	}
+	file, ok := os.LookupEnv(name + "_FILE")
+	if !ok {
+		return "", false, nil
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", false, fmt.Errorf("%s_FILE: %w", name, err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), true, nil
+}
+
+// HasEnvPassword reports whether the admin password is set by the environment
+func HasEnvPassword() bool {
+	for _, name := range []string{"PASSWORD", "PASSWORDHASH"} {
+		if _, ok, _ := LookupEnv(EnvPrefix + name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultWorkDir is WPKGUP_WORKDIR or a wpkgup2 folder in the user config dir
+func DefaultWorkDir() string {
+	if dir, ok := os.LookupEnv(EnvPrefix + "WORKDIR"); ok && dir != "" {
+		return dir
+	}
+	return FindAppDataFolder("wpkgup2")
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+func applyEnv(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Tag.Get("env") == "-" {
+			continue
+		}
+		name := prefix + strings.ToUpper(field.Name)
+		value := v.Field(i)
+
+		if value.Kind() == reflect.Struct && !value.Addr().Type().Implements(textUnmarshalerType) {
+			if err := applyEnv(value, name+"_"); err != nil {
+				return err
+			}
+			continue
+		}
+
+		env, ok, err := LookupEnv(name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if err := setFromString(value, env); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func setFromString(v reflect.Value, s string) error {
+	if unmarshaler, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return unmarshaler.UnmarshalText([]byte(s))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported list type %s", v.Type())
+		}
+		var list []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+	case reflect.Map:
+		entries := reflect.New(v.Type())
+		err := toml.NewDecoder(strings.NewReader(s)).DisallowUnknownFields().Decode(entries.Interface())
+		if err != nil {
+			return err
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		iter := entries.Elem().MapRange()
+		for iter.Next() {
+			v.SetMapIndex(iter.Key(), iter.Value())
+		}
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestApplyEnvMaps(t *testing.T) {
+	t.Setenv("WPKGUP_CHANNELS", `"app/beta" = { Private = true, Quota = "1KiB" }
+"*" = { KeepLast = 5, Pinned = ["1.0.0"] }`)
+	t.Setenv("WPKGUP_CLIENTCERTS", `"CN=ci" = { Role = "publisher", Components = ["app"] }`)
+	t.Setenv("WPKGUP_PRUNEINTERVAL", "2h")
+
+	conf := Config{
+		Channels: map[string]ChannelConfig{
+			"app/beta": {KeepDays: 7},
+			"app":      {KeepDays: 30},
+		},
+	}
+	if err := conf.ApplyEnv(); err != nil {
+		t.Fatal(err)
+	}
+
+	wantChannels := map[string]ChannelConfig{
+		"app/beta": {Private: true, Quota: 1024},
+		"app":      {KeepDays: 30},
+		"*":        {KeepLast: 5, Pinned: []string{"1.0.0"}},
+	}
+	if !reflect.DeepEqual(conf.Channels, wantChannels) {
+		t.Errorf("Channels = %+v, want %+v", conf.Channels, wantChannels)
+	}
+	wantCerts := map[string]ClientCertConfig{
+		"CN=ci": {Role: "publisher", Components: []string{"app"}},
+	}
+	if !reflect.DeepEqual(conf.ClientCerts, wantCerts) {
+		t.Errorf("ClientCerts = %+v, want %+v", conf.ClientCerts, wantCerts)
+	}
+	if time.Duration(conf.PruneInterval) != 2*time.Hour {
+		t.Errorf("PruneInterval = %v, want 2h", time.Duration(conf.PruneInterval))
+	}
+
+	t.Setenv("WPKGUP_CHANNELS", `app = { Privat = true }`)
+	if err := conf.ApplyEnv(); err == nil {
+		t.Error("ApplyEnv accepted an unknown channel option")
+	}
+}
@@ -1,28 +1,208 @@
 package config
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
-	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/pelletier/go-toml/v2"
+	"wpkg.dev/wpkgup/crypto"
 )
 
-var LoadedConfig Config
-
 type Config struct {
-	Password string
+	// Password is the plain text admin password of old configs, the server
+	// replaces it with PasswordHash on start
+	Password     string `toml:",omitempty" env:"-"`
+	PasswordHash string
+	// RequireUploadToken rejects uploads without a publisher token
+	RequireUploadToken bool
+	Server             ServerConfig
+	Log                LogConfig
+	TLS                TLSConfig
+	Storage            StorageConfig
+	// PruneInterval is how often the server applies retention policies
+	PruneInterval Duration
+	// ClientCerts maps subjects of TLS client certificates, like
+	// "CN=ci,O=Example", to identities
+	ClientCerts map[string]ClientCertConfig
+	// Channels holds settings of channels keyed by "component/channel",
+	// "component" applies to all channels of a component and "*" to all
+	Channels map[string]ChannelConfig
+}
+
+type ChannelConfig struct {
+	// KeepLast keeps the N most recently published versions of every target
+	KeepLast int
+	// KeepDays keeps versions published in the last N days
+	KeepDays int
+	// Pinned versions are never pruned
+	Pinned []string
+	// Quota limits the bytes stored in the section, a component section
+	// limits all channels of the component together
+	Quota ByteSize
+	// Private sections can only be read with a token
+	Private bool
+}
+
+// HasRetention reports whether old versions of the channel should be pruned
+func (c ChannelConfig) HasRetention() bool {
+	return c.KeepLast > 0 || c.KeepDays > 0
+}
+
+type ServerConfig struct {
+	// Listen holds the addresses the server listens on, like "0.0.0.0:8080"
+	// or "[::1]:8080"
+	Listen []string
+	// TrustedProxies may set X-Forwarded-For, used for IP bound download links
+	TrustedProxies []string
+	// MaxUploadSize limits the size of an upload request, 0 allows any size
+	MaxUploadSize ByteSize
+	// MaxHeaderBytes limits the size of request headers, 0 uses 1 MiB
+	MaxHeaderBytes ByteSize
+	// Timeouts of http.Server, 0 disables them. WriteTimeout limits the
+	// duration of downloads and ReadTimeout the duration of uploads.
+	ReadHeaderTimeout Duration
+	ReadTimeout       Duration
+	WriteTimeout      Duration
+	IdleTimeout       Duration
+	// ShutdownTimeout is how long in-flight requests are drained on SIGTERM
+	ShutdownTimeout Duration
+}
+
+type LogConfig struct {
+	// File receives the log instead of stderr
+	File string
+	// DisableAccessLog stops logging every request
+	DisableAccessLog bool
+	// Level is debug, info (default), warn or error
+	Level string
+	// Format is logfmt (default) or json
+	Format string
+}
+
+type ClientCertConfig struct {
+	// Name is logged for requests of the certificate, defaults to the subject
+	Name string
+	// Role is reader, publisher or admin
+	Role string
+	// Components limits the certificate to these components, empty allows all
+	Components []string
+}
+
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	// MinVersion is "1.2" (default) or "1.3"
+	MinVersion string
+	// ClientCAFile verifies client certificates signed by these CAs
+	ClientCAFile      string
+	RequireClientCert bool
+	// RedirectAddress serves redirects from plain HTTP to HTTPS, like ":80"
+	RedirectAddress string
+}
+
+// Enabled reports whether the server should serve HTTPS
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" && c.KeyFile != ""
 }
 
+type StorageConfig struct {
+	// Backend is "local" (default), "s3" or "memory", which loses all content
+	// on restart
+	Backend string
+	S3      S3Config
+}
+
+type S3Config struct {
+	Endpoint   string
+	Region     string
+	Bucket     string
+	Prefix     string
+	AccessKey  string
+	SecretKey  string
+	DisableSSL bool
+	// PresignDownloads redirects binary downloads to presigned URLs
+	PresignDownloads bool
+	PresignExpiry    Duration
+}
+
+// SetPassword replaces the admin password with a hash of password
+func (c *Config) SetPassword(password string) error {
+	hash, err := crypto.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	c.Password = ""
+	c.PasswordHash = hash
+	return nil
+}
+
+// CheckPassword reports whether password is the admin password
+func (c Config) CheckPassword(password string) bool {
+	if c.PasswordHash == "" {
+		return false
+	}
+	ok, err := crypto.VerifyPassword(c.PasswordHash, password)
+	return err == nil && ok
+}
+
+// Channel returns the most specific settings of a channel
+func (c Config) Channel(component, channel string) ChannelConfig {
+	for _, key := range []string{component + "/" + channel, component, "*"} {
+		if conf, ok := c.Channels[key]; ok {
+			return conf
+		}
+	}
+	return ChannelConfig{}
+}
+
+// IsPrivate reports whether reading a channel requires a token. A private
+// component or "*" section makes all channels private, channel "" checks the
+// component itself.
+func (c Config) IsPrivate(component, channel string) bool {
+	keys := []string{component, "*"}
+	if channel != "" {
+		keys = append(keys, component+"/"+channel)
+	}
+	for _, key := range keys {
+		if c.Channels[key].Private {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultListen is the listen address of a config without one
+const DefaultListen = "0.0.0.0:8080"
+
+func (c *Config) applyDefaults() {
+	if len(c.Server.Listen) == 0 {
+		c.Server.Listen = []string{DefaultListen}
+	}
+}
+
+// Init loads the config of the workdir, environment variables replace options
+// of the file and defaults fill the missing ones. The file is optional if the
+// environment sets the admin password.
 func Init() error {
-	configFilePath := filepath.Join(WorkDir, ConfigFile)
-	b, err := os.ReadFile(configFilePath)
+	conf, unknown, err := load()
 	if err != nil {
 		return err
 	}
+	for _, key := range unknown {
+		fmt.Println("Warning: unknown config key " + key)
+	}
 
-	return toml.Unmarshal(b, &LoadedConfig)
+	Set(conf)
+	return nil
 }
 
+// Parse reads a config file as it is, without defaults and environment
 func Parse(path string) (Config, error) {
 	var ConfigSettings Config
 	b, err := os.ReadFile(path)
@@ -30,18 +210,75 @@ func Parse(path string) (Config, error) {
 		return ConfigSettings, err
 	}
 
-	toml.Unmarshal(b, &ConfigSettings)
-	return ConfigSettings, nil
+	err = toml.Unmarshal(b, &ConfigSettings)
+	return ConfigSettings, err
 }
 
-func Save(config Config, path string) error {
-	b, err := toml.Marshal(config)
+// ParseStrict reads a config file like Parse and also returns its keys which
+// aren't config options
+func ParseStrict(path string) (Config, []string, error) {
+	var ConfigSettings Config
+	b, err := os.ReadFile(path)
 	if err != nil {
+		return ConfigSettings, nil, err
+	}
+
+	err = toml.NewDecoder(bytes.NewReader(b)).DisallowUnknownFields().Decode(&ConfigSettings)
+	var strictErr *toml.StrictMissingError
+	if !errors.As(err, &strictErr) {
+		return ConfigSettings, nil, err
+	}
+
+	var unknown []string
+	for _, e := range strictErr.Errors {
+		row, _ := e.Position()
+		unknown = append(unknown, strings.Join(e.Key(), ".")+" (line "+strconv.Itoa(row)+")")
+	}
+	return ConfigSettings, unknown, nil
+}
+
+var passwordKey = regexp.MustCompile(`^\s*["']?Password(Hash)?["']?\s*=`)
+
+// SavePassword sets PasswordHash of the config file at path to hash in place
+// of the current Password or PasswordHash, the rest of the file is kept as it
+// is. The file is created if it doesn't exist.
+func SavePassword(path, hash string) error {
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
 		return err
 	}
-	err = os.WriteFile(path, b, 0664)
+	line, err := toml.Marshal(struct{ PasswordHash string }{hash})
 	if err != nil {
 		return err
 	}
-	return nil
+
+	var lines []string
+	if len(b) > 0 {
+		lines = strings.SplitAfter(string(b), "\n")
+	}
+	// top level keys must come before the first table
+	tables := len(lines)
+	for i, l := range lines {
+		if strings.HasPrefix(strings.TrimSpace(l), "[") {
+			tables = i
+			break
+		}
+	}
+
+	var out []string
+	replaced := false
+	for i, l := range lines {
+		if i < tables && passwordKey.MatchString(l) {
+			if !replaced {
+				out = append(out, string(line))
+				replaced = true
+			}
+			continue
+		}
+		out = append(out, l)
+	}
+	if !replaced {
+		out = append([]string{string(line)}, out...)
+	}
+	return os.WriteFile(path, []byte(strings.Join(out, "")), 0664)
 }
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSavePassword(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		want string
+	}{
+		{"missing", "", "PasswordHash = 'hash'\n"},
+		{
+			"replace hash",
+			"# admin\nPasswordHash = \"old\" # comment\nPruneInterval = \"1h\"\n\n[Server]\nListen = [\"0.0.0.0:8080\"]\n",
+			"# admin\nPasswordHash = 'hash'\nPruneInterval = \"1h\"\n\n[Server]\nListen = [\"0.0.0.0:8080\"]\n",
+		},
+		{
+			"replace plain text",
+			"RequireUploadToken = true\nPassword = 'secret'\n[Log]\nLevel = \"debug\"",
+			"RequireUploadToken = true\nPasswordHash = 'hash'\n[Log]\nLevel = \"debug\"",
+		},
+		{
+			"both",
+			"Password = \"secret\"\n  PasswordHash = \"old\"\n",
+			"PasswordHash = 'hash'\n",
+		},
+		{
+			"add",
+			"# config\n[Channels.\"app/beta\"]\nPrivate = true\n",
+			"PasswordHash = 'hash'\n# config\n[Channels.\"app/beta\"]\nPrivate = true\n",
+		},
+		{
+			"keep keys of tables",
+			"[S3]\nPassword = 1\n",
+			"PasswordHash = 'hash'\n[S3]\nPassword = 1\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), ConfigFile)
+			if test.file != "" {
+				if err := os.WriteFile(path, []byte(test.file), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := SavePassword(path, "hash"); err != nil {
+				t.Fatal(err)
+			}
+			b, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != test.want {
+				t.Errorf("file is\n%s\nwant\n%s", b, test.want)
+			}
+		})
+	}
+}
@@ -2,5 +2,8 @@ package config
 
 const ContentDir = "content"
 const KeyringDir = "keyring"
+const TempDir = "tmp"
 const ConfigFile = "wpkgup.config"
 const KeystoreFile = "keystore.json"
+const TokensFile = "tokens.json"
+const ShareKeyFile = "share.key"
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+)
+
+var current atomic.Pointer[Config]
+
+// Current returns the config in use. It is replaced as a whole on reload and
+// must not be modified.
+func Current() *Config {
+	if conf := current.Load(); conf != nil {
+		return conf
+	}
+	return &Config{}
+}
+
+// Set replaces the config in use
+func Set(conf Config) {
+	current.Store(&conf)
+}
+
+// Loaded reports whether a config has been set, Current returns an empty one
+// until then
+func Loaded() bool {
+	return current.Load() != nil
+}
+
+var override func(*Config)
+
+// SetOverride registers options which take precedence over the config file
+// and environment, like command line flags, also applied on reload
+func SetOverride(f func(*Config)) {
+	override = f
+}
+
+// load reads the config of the workdir with environment, overrides and
+// defaults applied, and returns the keys of the file which aren't options
+func load() (Config, []string, error) {
+	conf, unknown, err := ParseStrict(filepath.Join(WorkDir, ConfigFile))
+	//the environment can replace the config file
+	if errors.Is(err, fs.ErrNotExist) && HasEnvPassword() {
+		err = nil
+	}
+	if err != nil {
+		return conf, nil, err
+	}
+
+	err = conf.ApplyEnv()
+	if err != nil {
+		return conf, nil, err
+	}
+	if override != nil {
+		override(&conf)
+	}
+	conf.applyDefaults()
+
+	//plain text passwords are replaced in the file on the next start, until
+	//then the current hash is kept on reload if the password didn't change
+	if conf.Password != "" {
+		if current := Current(); current.CheckPassword(conf.Password) {
+			conf.Password = ""
+			conf.PasswordHash = current.PasswordHash
+		} else if err := conf.SetPassword(conf.Password); err != nil {
+			return conf, nil, err
+		}
+	}
+	return conf, unknown, nil
+}
+
+// restartOptions are only applied when the server starts
+var restartOptions = []string{"Server.Listen", "Server.TrustedProxies", "Server.MaxHeaderBytes", "Server.ReadHeaderTimeout", "Server.ReadTimeout", "Server.WriteTimeout", "Server.IdleTimeout", "TLS.", "Log.", "Storage."}
+
+// RequiresRestart reports whether a changed option is only applied on start
+func RequiresRestart(option string) bool {
+	for _, prefix := range restartOptions {
+		if strings.HasPrefix(option, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reload reads the config again and replaces the current one if it is valid,
+// otherwise the current one is kept. It returns the changed options and the
+// unknown keys of the file.
+func Reload() ([]string, []string, error) {
+	conf, unknown, err := load()
+	if err != nil {
+		return nil, nil, err
+	}
+	if errs := conf.Validate(); len(errs) > 0 {
+		messages := make([]string, len(errs))
+		for i, err := range errs {
+			messages[i] = err.Error()
+		}
+		return nil, unknown, errors.New(strings.Join(messages, "; "))
+	}
+
+	changed := changedOptions(reflect.ValueOf(*Current()), reflect.ValueOf(conf), "")
+	Set(conf)
+	return changed, unknown, nil
+}
+
+// changedOptions returns the paths of the options which differ, without
+// their values as some are secrets
+func changedOptions(old, new reflect.Value, prefix string) []string {
+	var changed []string
+	t := old.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := prefix + t.Field(i).Name
+		a, b := old.Field(i), new.Field(i)
+
+		switch {
+		case a.Kind() == reflect.Struct:
+			changed = append(changed, changedOptions(a, b, name+".")...)
+		case a.Kind() == reflect.Map:
+			for _, key := range mapKeys(a, b) {
+				x, y := a.MapIndex(key), b.MapIndex(key)
+				if !x.IsValid() || !y.IsValid() || !reflect.DeepEqual(x.Interface(), y.Interface()) {
+					changed = append(changed, fmt.Sprintf("%s[%v]", name, key))
+				}
+			}
+		case !reflect.DeepEqual(a.Interface(), b.Interface()):
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
+func mapKeys(a, b reflect.Value) []reflect.Value {
+	keys := a.MapKeys()
+	for _, key := range b.MapKeys() {
+		if !a.MapIndex(key).IsValid() {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
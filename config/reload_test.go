@@ -0,0 +1,85 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReloadKeepsPasswordHash(t *testing.T) {
+	WorkDir = t.TempDir()
+	current.Store(nil)
+	t.Cleanup(func() { current.Store(nil) })
+	if Loaded() {
+		t.Fatal("Loaded before Init")
+	}
+	path := filepath.Join(WorkDir, ConfigFile)
+	if err := os.WriteFile(path, []byte("Password = \"secret\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+	if !Loaded() {
+		t.Fatal("not Loaded after Init")
+	}
+	hash := Current().PasswordHash
+	if !Current().CheckPassword("secret") {
+		t.Fatal("password of the file isn't accepted")
+	}
+
+	changed, _, err := Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changed) > 0 || Current().PasswordHash != hash {
+		t.Errorf("reload without changes changed %q", changed)
+	}
+
+	t.Setenv("WPKGUP_PASSWORD", "other")
+	changed, _, err = Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changed) != 1 || changed[0] != "PasswordHash" || !Current().CheckPassword("other") {
+		t.Errorf("reload with a new password changed %q", changed)
+	}
+	hash = Current().PasswordHash
+
+	changed, _, err = Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changed) > 0 || Current().PasswordHash != hash {
+		t.Errorf("reload with the same environment changed %q", changed)
+	}
+}
+
+func TestReloadTLSRequiresRestart(t *testing.T) {
+	WorkDir = t.TempDir()
+	current.Store(nil)
+	t.Cleanup(func() { current.Store(nil) })
+	path := filepath.Join(WorkDir, ConfigFile)
+	if err := os.WriteFile(path, []byte("Password = \"secret\"\n[TLS]\nMinVersion = \"1.2\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte("Password = \"secret\"\n[TLS]\nMinVersion = \"1.3\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	changed, _, err := Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changed) != 1 || changed[0] != "TLS.MinVersion" {
+		t.Fatalf("reload changed %q", changed)
+	}
+	for _, option := range append(changed, "TLS.CertFile", "TLS.KeyFile", "TLS.ClientCAFile") {
+		if !RequiresRestart(option) {
+			t.Errorf("%s is applied without restart", option)
+		}
+	}
+}
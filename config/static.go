@@ -3,3 +3,6 @@ package config
 var (
 	Version string
 )
+
+// DefaultPassword is only accepted when explicitly allowed
+const DefaultPassword = "1@Qwerty"
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Duration is a time.Duration written as a string like "1h30m" in the config
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	duration, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+// ByteSize is a number of bytes, written either as a plain number or with a
+// binary unit suffix like "512M" or "10GiB" in the config
+type ByteSize int64
+
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"TIB", 1 << 40}, {"GIB", 1 << 30}, {"MIB", 1 << 20}, {"KIB", 1 << 10},
+	{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+	{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10},
+	{"B", 1},
+}
+
+func (b ByteSize) MarshalText() ([]byte, error) {
+	return []byte(strconv.FormatInt(int64(b), 10)), nil
+}
+
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	s := strings.ToUpper(strings.TrimSpace(string(text)))
+
+	multiplier := int64(1)
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			multiplier = unit.size
+			break
+		}
+	}
+
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || value < 0 {
+		return fmt.Errorf("invalid size: %s", text)
+	}
+	*b = ByteSize(value * float64(multiplier))
+	return nil
+}
+
+func (b ByteSize) String() string {
+	for _, unit := range byteUnits[:4] {
+		if int64(b) >= unit.size {
+			return strconv.FormatFloat(float64(b)/float64(unit.size), 'f', 1, 64) + " " + strings.Replace(unit.suffix, "IB", "iB", 1)
+		}
+	}
+	return strconv.FormatInt(int64(b), 10) + " B"
+}
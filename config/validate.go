@@ -0,0 +1,151 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"wpkg.dev/wpkgup/crypto"
+	"wpkg.dev/wpkgup/logging"
+)
+
+// Validate returns every invalid value of the config
+func (c Config) Validate() []error {
+	var errs []error
+	check := func(field string, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field, err))
+		}
+	}
+
+	if c.PasswordHash == "" && c.Password == "" {
+		check("PasswordHash", errors.New("not set, use set-password"))
+	}
+	if c.PasswordHash != "" {
+		check("PasswordHash", crypto.ValidatePasswordHash(c.PasswordHash))
+	}
+
+	for _, addr := range c.Server.Listen {
+		check("Server.Listen", validateAddress(addr))
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				check("Server.TrustedProxies", fmt.Errorf("%q is no IP address or CIDR", proxy))
+			}
+		}
+	}
+	check("Server.ReadHeaderTimeout", notNegative(c.Server.ReadHeaderTimeout))
+	check("Server.ReadTimeout", notNegative(c.Server.ReadTimeout))
+	check("Server.WriteTimeout", notNegative(c.Server.WriteTimeout))
+	check("Server.IdleTimeout", notNegative(c.Server.IdleTimeout))
+	check("Server.ShutdownTimeout", notNegative(c.Server.ShutdownTimeout))
+	check("PruneInterval", notNegative(c.PruneInterval))
+
+	if c.Log.File != "" {
+		check("Log.File", dirExists(filepath.Dir(c.Log.File)))
+	}
+	_, err := logging.ParseLevel(c.Log.Level)
+	check("Log.Level", err)
+	switch c.Log.Format {
+	case "", "logfmt", "json":
+	default:
+		check("Log.Format", fmt.Errorf("%q is not supported, expected logfmt or json", c.Log.Format))
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		check("TLS", errors.New("CertFile and KeyFile must be set together"))
+	}
+	for field, file := range map[string]string{"TLS.CertFile": c.TLS.CertFile, "TLS.KeyFile": c.TLS.KeyFile, "TLS.ClientCAFile": c.TLS.ClientCAFile} {
+		if file != "" {
+			_, err := os.Stat(file)
+			check(field, err)
+		}
+	}
+	switch c.TLS.MinVersion {
+	case "", "1.2", "1.3":
+	default:
+		check("TLS.MinVersion", fmt.Errorf("%q is not supported, expected 1.2 or 1.3", c.TLS.MinVersion))
+	}
+	if c.TLS.RequireClientCert && c.TLS.ClientCAFile == "" {
+		check("TLS.RequireClientCert", errors.New("requires ClientCAFile"))
+	}
+	if c.TLS.RedirectAddress != "" {
+		if !c.TLS.Enabled() {
+			check("TLS.RedirectAddress", errors.New("requires CertFile and KeyFile"))
+		}
+		check("TLS.RedirectAddress", validateAddress(c.TLS.RedirectAddress))
+	}
+
+	switch c.Storage.Backend {
+	case "", "local", "memory":
+	case "s3":
+		if c.Storage.S3.Endpoint == "" {
+			check("Storage.S3.Endpoint", errors.New("required by the s3 backend"))
+		}
+		if c.Storage.S3.Bucket == "" {
+			check("Storage.S3.Bucket", errors.New("required by the s3 backend"))
+		}
+		check("Storage.S3.PresignExpiry", notNegative(c.Storage.S3.PresignExpiry))
+	default:
+		check("Storage.Backend", fmt.Errorf("%q is not supported, expected local, memory or s3", c.Storage.Backend))
+	}
+
+	for subject, cert := range c.ClientCerts {
+		switch cert.Role {
+		case "reader", "publisher", "admin":
+		default:
+			check("ClientCerts."+subject+".Role", fmt.Errorf("%q is not supported, expected reader, publisher or admin", cert.Role))
+		}
+	}
+
+	for key, channel := range c.Channels {
+		field := "Channels." + key
+		if key != "*" {
+			segments := strings.Split(key, "/")
+			if len(segments) > 2 || segments[0] == "" || (len(segments) == 2 && segments[1] == "") {
+				check(field, errors.New("expected \"*\", \"component\" or \"component/channel\""))
+			}
+		}
+		if channel.KeepLast < 0 {
+			check(field+".KeepLast", errors.New("must not be negative"))
+		}
+		if channel.KeepDays < 0 {
+			check(field+".KeepDays", errors.New("must not be negative"))
+		}
+	}
+	return errs
+}
+
+func validateAddress(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return fmt.Errorf("invalid port in %q", addr)
+	}
+	return nil
+}
+
+func notNegative(d Duration) error {
+	if d < 0 {
+		return errors.New("must not be negative")
+	}
+	return nil
+}
+
+func dirExists(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return errors.New(dir + " is not a directory")
+	}
+	return nil
+}
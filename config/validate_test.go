@@ -0,0 +1,30 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidatePasswordHash(t *testing.T) {
+	var conf Config
+	if err := conf.SetPassword("secret"); err != nil {
+		t.Fatal(err)
+	}
+	for _, err := range conf.Validate() {
+		if strings.HasPrefix(err.Error(), "PasswordHash") {
+			t.Errorf("valid hash rejected: %v", err)
+		}
+	}
+
+	conf.PasswordHash = strings.Replace(conf.PasswordHash, "t=3", "t=0", 1)
+	found := false
+	for _, err := range conf.Validate() {
+		found = found || strings.HasPrefix(err.Error(), "PasswordHash")
+	}
+	if !found {
+		t.Error("hash with t=0 passed validation")
+	}
+	if conf.CheckPassword("secret") {
+		t.Error("hash with t=0 accepted the password")
+	}
+}
@@ -2,8 +2,10 @@ package crypto
 
 import (
 	"crypto/ecdsa"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/pem"
 	"errors"
 	"fmt"
@@ -106,3 +108,13 @@ func PublicKeyToBase64(key *ecdsa.PublicKey) (string, error) {
 
 	return base64Key, nil
 }
+
+// Fingerprint identifies a public key by the SHA-256 of its PKIX encoding
+func Fingerprint(key *ecdsa.PublicKey) (string, error) {
+	keyBytes, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(keyBytes)
+	return hex.EncodeToString(sum[:]), nil
+}
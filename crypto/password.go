@@ -0,0 +1,106 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// argon2id parameters, stored in the hash so they can be raised later
+const (
+	argonTime    = 3
+	argonMemory  = 64 * 1024
+	argonThreads = 4
+	argonKeyLen  = 32
+	argonSaltLen = 16
+)
+
+var errInvalidHash = errors.New("invalid password hash")
+
+// HashPassword returns a salted argon2id hash of password in PHC string format
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, argonSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, argonMemory, argonTime, argonThreads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// limits of hashes accepted by VerifyPassword, so a config can't make every
+// login panic or exhaust memory
+const (
+	maxArgonTime = 16
+	// maxArgonMemory is in KiB like argonMemory
+	maxArgonMemory  = 256 * 1024
+	maxArgonThreads = 64
+	minArgonKeyLen  = 16
+	maxArgonKeyLen  = 64
+	minArgonSaltLen = 8
+)
+
+type passwordHash struct {
+	memory, time uint32
+	threads      uint8
+	salt, key    []byte
+}
+
+func parsePasswordHash(hash string) (passwordHash, error) {
+	var h passwordHash
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return h, errInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return h, errInvalidHash
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.memory, &h.time, &h.threads); err != nil {
+		return h, errInvalidHash
+	}
+	if h.time < 1 || h.time > maxArgonTime || h.threads < 1 || h.threads > maxArgonThreads ||
+		h.memory < 8*uint32(h.threads) || h.memory > maxArgonMemory {
+		return h, fmt.Errorf("%w: parameters out of range", errInvalidHash)
+	}
+
+	var err error
+	h.salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(h.salt) < minArgonSaltLen {
+		return h, errInvalidHash
+	}
+	h.key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(h.key) < minArgonKeyLen || len(h.key) > maxArgonKeyLen {
+		return h, errInvalidHash
+	}
+	return h, nil
+}
+
+// ValidatePasswordHash returns an error if hash can't be verified by
+// VerifyPassword
+func ValidatePasswordHash(hash string) error {
+	_, err := parsePasswordHash(hash)
+	return err
+}
+
+// VerifyPassword reports whether password matches hash in constant time
+func VerifyPassword(hash, password string) (bool, error) {
+	h, err := parsePasswordHash(hash)
+	if err != nil {
+		return false, err
+	}
+
+	key := argon2.IDKey([]byte(password), h.salt, h.time, h.memory, h.threads, uint32(len(h.key)))
+	return subtle.ConstantTimeCompare(key, h.key) == 1, nil
+}
@@ -0,0 +1,52 @@
+package crypto
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyPassword(t *testing.T) {
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidatePasswordHash(hash); err != nil {
+		t.Fatalf("hash of HashPassword is invalid: %v", err)
+	}
+	if ok, err := VerifyPassword(hash, "secret"); err != nil || !ok {
+		t.Errorf("VerifyPassword(secret) = %v, %v", ok, err)
+	}
+	if ok, err := VerifyPassword(hash, "other"); err != nil || ok {
+		t.Errorf("VerifyPassword(other) = %v, %v", ok, err)
+	}
+
+	parts := strings.Split(hash, "$")
+	withParams := func(params string) string {
+		return strings.Join([]string{"", parts[1], parts[2], params, parts[4], parts[5]}, "$")
+	}
+	invalid := []string{
+		"",
+		"plain",
+		"$argon2i$v=19$m=65536,t=3,p=4$" + parts[4] + "$" + parts[5],
+		"$argon2id$v=16$m=65536,t=3,p=4$" + parts[4] + "$" + parts[5],
+		withParams("m=65536,t=0,p=4"),
+		withParams("m=65536,t=3,p=0"),
+		withParams("m=65536,t=3,p=300"),
+		withParams("m=65536,t=100000,p=4"),
+		withParams("m=4294967295,t=3,p=4"),
+		withParams("m=8,t=3,p=4"),
+		withParams("m=65536,t=3"),
+		withParams("m=65536,t=3,p=4") + "$",
+		strings.Join([]string{"", parts[1], parts[2], parts[3], "c2FsdA", parts[5]}, "$"),
+		strings.Join([]string{"", parts[1], parts[2], parts[3], parts[4], "a2V5"}, "$"),
+		strings.Join([]string{"", parts[1], parts[2], parts[3], parts[4], "!"}, "$"),
+	}
+	for _, hash := range invalid {
+		if err := ValidatePasswordHash(hash); err == nil {
+			t.Errorf("ValidatePasswordHash(%q) accepted it", hash)
+		}
+		if ok, err := VerifyPassword(hash, "secret"); err == nil || ok {
+			t.Errorf("VerifyPassword(%q) = %v, %v", hash, ok, err)
+		}
+	}
+}
@@ -1,18 +1,41 @@
 package keystore
 
 import (
+	"crypto/ecdsa"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"wpkg.dev/wpkgup/config"
 	"wpkg.dev/wpkgup/crypto"
+	"wpkg.dev/wpkgup/logging"
 	"wpkg.dev/wpkgup/utils"
 )
 
 var KeystorePath string
 
+// Key is a parsed authorized key
+type Key struct {
+	// Fingerprint identifies the key, clients send it along the signature
+	Fingerprint string
+	// Encoded is the base64 form stored in the keystore file
+	Encoded   string
+	PublicKey *ecdsa.PublicKey
+}
+
+// loadedKeys are the keys of the keystore file indexed by fingerprint, they
+// are replaced as a whole by Load
+var (
+	mutex      sync.RWMutex
+	loadedKeys = map[string]Key{}
+	loaded     bool
+)
+
+// writeMutex serializes changes of the keystore file
+var writeMutex sync.Mutex
+
 type AuthorizedKeys struct {
 	Keys []string `json:"authorized_keys"`
 }
@@ -23,9 +46,79 @@ func Init() error {
 		keys := AuthorizedKeys{
 			Keys: []string{},
 		}
-		return saveJson(keys, KeystorePath)
+		if err := saveJson(keys, KeystorePath); err != nil {
+			return err
+		}
+	}
+	// a bad key doesn't keep the server from starting
+	_, _, err := load(true)
+	return err
+}
+
+func parseKey(encoded string) (Key, error) {
+	publicKey, err := crypto.ParsePublicKeyFromString(encoded)
+	if err != nil {
+		return Key{}, err
+	}
+	fingerprint, err := crypto.Fingerprint(publicKey)
+	if err != nil {
+		return Key{}, err
+	}
+	return Key{Fingerprint: fingerprint, Encoded: encoded, PublicKey: publicKey}, nil
+}
+
+// Load reads the keystore file into memory and returns the number of added and
+// removed keys. The keys in memory are kept if the file or one of its keys is
+// invalid.
+func Load() (int, int, error) {
+	return load(false)
+}
+
+// load reads the keystore file like Load, skipInvalid leaves out invalid keys
+// with a warning instead of rejecting the file
+func load(skipInvalid bool) (int, int, error) {
+	authorizedKeys, err := readJson(KeystorePath)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	keys := map[string]Key{}
+	for _, encoded := range authorizedKeys.Keys {
+		key, err := parseKey(encoded)
+		if err != nil && skipInvalid {
+			logging.Default().Warn("skipping invalid key", "key", encoded, "error", err)
+			continue
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid key %s: %w", encoded, err)
+		}
+		keys[key.Fingerprint] = key
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	added, removed := 0, 0
+	for fingerprint := range keys {
+		if _, ok := loadedKeys[fingerprint]; !ok {
+			added++
+		}
 	}
-	return nil
+	for fingerprint := range loadedKeys {
+		if _, ok := keys[fingerprint]; !ok {
+			removed++
+		}
+	}
+	loadedKeys = keys
+	loaded = true
+	return added, removed, nil
+}
+
+// Loaded reports whether the keystore file has been loaded
+func Loaded() bool {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return loaded
 }
 
 func saveJson(keys AuthorizedKeys, path string) error {
@@ -33,11 +126,14 @@ func saveJson(keys AuthorizedKeys, path string) error {
 	if err != nil {
 		return err
 	}
-	err = os.WriteFile(path, b, 0664)
+
+	// the keystore is reloaded when the file changes, so it is replaced at once
+	temp := path + ".tmp"
+	err = os.WriteFile(temp, b, 0664)
 	if err != nil {
 		return err
 	}
-	return nil
+	return os.Rename(temp, path)
 }
 
 func readJson(path string) (AuthorizedKeys, error) {
@@ -55,43 +151,52 @@ func readJson(path string) (AuthorizedKeys, error) {
 	return authorizedKeys, nil
 }
 
-func containsElement(arr []string, elementToFind string) bool {
-	for _, element := range arr {
-		if element == elementToFind {
-			return true
-		}
+func AddKey(encoded string) error {
+	key, err := parseKey(encoded)
+	if err != nil {
+		return err
 	}
-	return false
-}
 
-func AddKey(key string) error {
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+
 	keys, err := readJson(KeystorePath)
 	if err != nil {
 		return err
 	}
 
-	if containsElement(keys.Keys, key) {
-		return fmt.Errorf("this key is already authorized")
+	for _, existing := range keys.Keys {
+		if existingKey, err := parseKey(existing); err == nil && existingKey.Fingerprint == key.Fingerprint {
+			return fmt.Errorf("this key is already authorized")
+		}
 	}
 
-	keys.Keys = append(keys.Keys, key)
-
-	_, err = crypto.ParsePublicKeyFromString(key)
-	if err != nil {
-		return err
-	}
+	keys.Keys = append(keys.Keys, encoded)
 
 	err = saveJson(keys, KeystorePath)
 	if err != nil {
 		return err
 	}
-	return nil
+	_, _, err = load(true)
+	return err
 }
 
-func GetAllKeys() ([]string, error) {
-	keys, err := readJson(KeystorePath)
-	if err != nil {
-		return nil, err
+// Lookup returns the authorized key with the fingerprint
+func Lookup(fingerprint string) (Key, bool) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	key, ok := loadedKeys[fingerprint]
+	return key, ok
+}
+
+// Keys returns all authorized keys loaded in memory
+func Keys() []Key {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	keys := make([]Key, 0, len(loadedKeys))
+	for _, key := range loadedKeys {
+		keys = append(keys, key)
 	}
-	return keys.Keys, nil
+	return keys
 }
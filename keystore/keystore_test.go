@@ -0,0 +1,45 @@
+package keystore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"wpkg.dev/wpkgup/config"
+	"wpkg.dev/wpkgup/crypto"
+)
+
+func TestInvalidKeys(t *testing.T) {
+	config.WorkDir = t.TempDir()
+	_, publicKey, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := crypto.PublicKeyToBase64(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(config.WorkDir, config.KeystoreFile)
+	if err := saveJson(AuthorizedKeys{Keys: []string{encoded, "invalid"}}, path); err != nil {
+		t.Fatal(err)
+	}
+
+	// on start invalid keys are skipped
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+	if keys := Keys(); len(keys) != 1 || keys[0].Encoded != encoded {
+		t.Fatalf("Init loaded %d keys, want the valid one", len(keys))
+	}
+
+	// on reload the current keys are kept
+	if err := os.WriteFile(path, []byte(`{"authorized_keys":["invalid"]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Load(); err == nil {
+		t.Error("Load accepted an invalid key")
+	}
+	if keys := Keys(); len(keys) != 1 {
+		t.Errorf("Load replaced the keys with %d keys", len(keys))
+	}
+}
@@ -0,0 +1,201 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return "level(" + strconv.Itoa(int(l)) + ")"
+	}
+	return levelNames[l]
+}
+
+func ParseLevel(s string) (Level, error) {
+	if s == "" {
+		return LevelInfo, nil
+	}
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", s)
+}
+
+// output is shared by a logger and the loggers derived from it
+type output struct {
+	mutex sync.Mutex
+	w     io.Writer
+	level Level
+	json  bool
+}
+
+// Logger writes leveled entries with key value fields as logfmt or JSON lines
+type Logger struct {
+	out    *output
+	fields []interface{}
+}
+
+// New returns a logger writing entries of at least level in format, which is
+// "logfmt" (default) or "json"
+func New(w io.Writer, level Level, format string) (*Logger, error) {
+	out := &output{w: w, level: level}
+	switch format {
+	case "", "logfmt":
+	case "json":
+		out.json = true
+	default:
+		return nil, fmt.Errorf("unknown log format %q, expected logfmt or json", format)
+	}
+	return &Logger{out: out}, nil
+}
+
+var std, _ = New(os.Stderr, LevelInfo, "logfmt")
+
+// Default returns the logger of the process
+func Default() *Logger {
+	return std
+}
+
+// SetDefault replaces the logger of the process, it must be called before
+// logging starts
+func SetDefault(l *Logger) {
+	std = l
+}
+
+// With returns a logger adding the key value pairs to every entry
+func (l *Logger) With(keyValues ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keyValues))
+	fields = append(fields, l.fields...)
+	fields = append(fields, keyValues...)
+	return &Logger{out: l.out, fields: fields}
+}
+
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.out.level
+}
+
+func (l *Logger) Debug(msg string, keyValues ...interface{}) {
+	l.log(LevelDebug, msg, keyValues)
+}
+
+func (l *Logger) Info(msg string, keyValues ...interface{}) {
+	l.log(LevelInfo, msg, keyValues)
+}
+
+func (l *Logger) Warn(msg string, keyValues ...interface{}) {
+	l.log(LevelWarn, msg, keyValues)
+}
+
+func (l *Logger) Error(msg string, keyValues ...interface{}) {
+	l.log(LevelError, msg, keyValues)
+}
+
+func (l *Logger) log(level Level, msg string, keyValues []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	fields := []interface{}{"time", time.Now().Format(time.RFC3339Nano), "level", level.String(), "msg", msg}
+	fields = append(fields, l.fields...)
+	fields = append(fields, keyValues...)
+	if len(fields)%2 != 0 {
+		fields = append(fields[:len(fields)-1], "!BADKEY", fields[len(fields)-1])
+	}
+
+	var buf bytes.Buffer
+	if l.out.json {
+		writeJson(&buf, fields)
+	} else {
+		writeLogfmt(&buf, fields)
+	}
+	buf.WriteByte('\n')
+
+	l.out.mutex.Lock()
+	defer l.out.mutex.Unlock()
+	l.out.w.Write(buf.Bytes())
+}
+
+// value converts a field value to a string or a JSON number or bool
+func value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.String()
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case fmt.Stringer:
+		return v.String()
+	case string, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+func writeJson(buf *bytes.Buffer, fields []interface{}) {
+	buf.WriteByte('{')
+	for i := 0; i < len(fields); i += 2 {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(marshal(fmt.Sprint(fields[i])))
+		buf.WriteByte(':')
+		b := marshal(value(fields[i+1]))
+		if b == nil {
+			b = marshal(fmt.Sprint(fields[i+1]))
+		}
+		buf.Write(b)
+	}
+	buf.WriteByte('}')
+}
+
+// marshal encodes v as JSON without escaping HTML characters, it returns nil
+// if v can't be encoded
+func marshal(v interface{}) []byte {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
+
+func writeLogfmt(buf *bytes.Buffer, fields []interface{}) {
+	for i := 0; i < len(fields); i += 2 {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(fmt.Sprint(fields[i]))
+		buf.WriteByte('=')
+
+		s := fmt.Sprint(value(fields[i+1]))
+		if s == "" || strings.ContainsAny(s, " =\"\t\r\n\\") {
+			s = strconv.Quote(s)
+		}
+		buf.WriteString(s)
+	}
+}
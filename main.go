@@ -4,8 +4,11 @@ import (
 	"crypto/ecdsa"
 	"flag"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"wpkg.dev/wpkgup/client"
@@ -13,10 +16,12 @@ import (
 	"wpkg.dev/wpkgup/crypto"
 	"wpkg.dev/wpkgup/keystore"
 	"wpkg.dev/wpkgup/server"
+	"wpkg.dev/wpkgup/storage"
+	"wpkg.dev/wpkgup/tokens"
 	"wpkg.dev/wpkgup/utils"
 )
 
-var initFlag, serverFlag, genFlag, importKeysFlag, uploadKeysFlag, signBinaryFlag, uploadBinaryFlag *flag.FlagSet
+var initFlag, serverFlag, genFlag, importKeysFlag, uploadKeysFlag, signBinaryFlag, uploadBinaryFlag, setRolloutFlag, setMandatoryFlag, setMinVersionFlag, clearMinVersionFlag, gcFlag, pruneFlag, setPasswordFlag, tokenFlag, shareFlag, configFlag, healthcheckFlag *flag.FlagSet
 
 func help(argv0 string) {
 	fmt.Fprintln(os.Stderr, "\nWPKG Update Manager")
@@ -24,6 +29,14 @@ func help(argv0 string) {
 	fmt.Fprintln(os.Stderr, "\nCommands:")
 	fmt.Fprintln(os.Stderr, "\nserver - starting server")
 	serverFlag.PrintDefaults()
+	fmt.Fprintln(os.Stderr, "\nset-password - set server password")
+	setPasswordFlag.PrintDefaults()
+	fmt.Fprintln(os.Stderr, "\nconfig validate [flags] - Report unknown keys and invalid values of the config")
+	configFlag.PrintDefaults()
+	fmt.Fprintln(os.Stderr, "\nhealthcheck [flags] - Exit with 0 if the server is ready, for container health checks")
+	healthcheckFlag.PrintDefaults()
+	fmt.Fprintln(os.Stderr, "\ntoken create <name> | list | revoke <name> [flags] - Manage API tokens")
+	tokenFlag.PrintDefaults()
 	fmt.Fprintln(os.Stderr, "\ngen-keys - generating keys for client")
 	genFlag.PrintDefaults()
 	fmt.Fprintln(os.Stderr, "\nimport-keys - import keys for client")
@@ -33,6 +46,20 @@ func help(argv0 string) {
 	fmt.Fprintln(os.Stderr, "\nsign-binary <binary to sign> <sign file output> [flags] - Sign binary")
 	fmt.Fprintln(os.Stderr, "\nupload-binary <component> <channel> <os> <arch> <version> <filename> [flags] - Upload binary to server binary")
 	uploadBinaryFlag.PrintDefaults()
+	fmt.Fprintln(os.Stderr, "\nset-rollout <component> <channel> <os> <arch> <version> <percentage> [flags] - Set rollout percentage of a version")
+	setRolloutFlag.PrintDefaults()
+	fmt.Fprintln(os.Stderr, "\nshare <component> <channel> <os> <arch> <version> [flags] - Print a signed download link")
+	shareFlag.PrintDefaults()
+	fmt.Fprintln(os.Stderr, "\nset-mandatory <component> <channel> <os> <arch> <version> [flags] - Mark version as mandatory update")
+	setMandatoryFlag.PrintDefaults()
+	fmt.Fprintln(os.Stderr, "\nset-min-version <component> <channel> <version> [flags] - Set minimum supported version of channel")
+	setMinVersionFlag.PrintDefaults()
+	fmt.Fprintln(os.Stderr, "\nclear-min-version <component> <channel> [flags] - Remove minimum supported version of channel")
+	clearMinVersionFlag.PrintDefaults()
+	fmt.Fprintln(os.Stderr, "\ngc [flags] - Remove binaries which are not referenced by any version")
+	gcFlag.PrintDefaults()
+	fmt.Fprintln(os.Stderr, "\nprune [flags] - Remove versions according to channel retention policies")
+	pruneFlag.PrintDefaults()
 }
 
 func importKeys(privateKey *ecdsa.PrivateKey, keyringDir string) {
@@ -51,44 +78,155 @@ func importKeys(privateKey *ecdsa.PrivateKey, keyringDir string) {
 	fmt.Println("Key imported successfully!")
 }
 
+// credentials uses the API token if given, otherwise the server password
+// unless a client certificate authenticates the request
+func credentials(token, password, clientCert string) client.Credentials {
+	if token != "" {
+		return client.Credentials{Token: token}
+	}
+	if password == "" && clientCert != "" {
+		return client.Credentials{}
+	}
+	if password == "" {
+		fmt.Print("Enter server password: ")
+		password = utils.ScanRequired()
+	}
+	return client.Credentials{Password: password}
+}
+
 func main() {
 	gin.SetMode(gin.ReleaseMode)
 
 	var serverIp, workDir string
 	var serverPort int
+	var allowDefaultPassword bool
+	var tlsCert, tlsKey, tlsRedirect string
+	var newPassword string
 
 	serverFlag = flag.NewFlagSet("server", flag.ExitOnError)
 	serverFlag.StringVar(&serverIp, "i", "0.0.0.0", "Server IP")
 	serverFlag.IntVar(&serverPort, "p", 8080, "Server port")
-	serverFlag.StringVar(&workDir, "w", config.FindAppDataFolder("wpkgup2"), "Server workdir")
+	serverFlag.StringVar(&workDir, "w", config.DefaultWorkDir(), "Server workdir")
+	serverFlag.BoolVar(&allowDefaultPassword, "allow-default-password", false, "Allow starting with the default password")
+	serverFlag.StringVar(&tlsCert, "tls-cert", "", "TLS certificate file, enables HTTPS together with -tls-key")
+	serverFlag.StringVar(&tlsKey, "tls-key", "", "TLS private key file")
+	serverFlag.StringVar(&tlsRedirect, "tls-redirect", "", "Redirect plain HTTP requests on this address to HTTPS, like :80")
+
+	setPasswordFlag = flag.NewFlagSet("set-password", flag.ExitOnError)
+	setPasswordFlag.StringVar(&workDir, "w", config.DefaultWorkDir(), "Server workdir")
+	setPasswordFlag.StringVar(&newPassword, "p", "", "New password")
+
+	var configFile string
+
+	configFlag = flag.NewFlagSet("config validate", flag.ExitOnError)
+	configFlag.StringVar(&workDir, "w", config.DefaultWorkDir(), "Server workdir")
+	configFlag.StringVar(&configFile, "c", "", "Config file, defaults to the one of the workdir")
+
+	var tokenRole string
+
+	tokenFlag = flag.NewFlagSet("token", flag.ExitOnError)
+	tokenFlag.StringVar(&workDir, "w", config.DefaultWorkDir(), "Server workdir")
+	tokenFlag.StringVar(&tokenRole, "role", string(tokens.RolePublisher), "Role of created token: reader, publisher or admin")
 
 	genFlag = flag.NewFlagSet("gen-keys", flag.ExitOnError)
-	genFlag.StringVar(&workDir, "w", config.FindAppDataFolder("wpkgup2"), "Server workdir")
+	genFlag.StringVar(&workDir, "w", config.DefaultWorkDir(), "Server workdir")
 
 	initFlag = flag.NewFlagSet("init", flag.ExitOnError)
-	initFlag.StringVar(&workDir, "w", config.FindAppDataFolder("wpkgup2"), "Server workdir")
+	initFlag.StringVar(&workDir, "w", config.DefaultWorkDir(), "Server workdir")
 
 	var keyFile, keyString string
 
 	importKeysFlag = flag.NewFlagSet("import-keys", flag.ExitOnError)
-	importKeysFlag.StringVar(&workDir, "w", config.FindAppDataFolder("wpkgup2"), "Server workdir")
+	importKeysFlag.StringVar(&workDir, "w", config.DefaultWorkDir(), "Server workdir")
 	importKeysFlag.StringVar(&keyString, "k", "", "Private key to import")
 	importKeysFlag.StringVar(&keyFile, "kf", "", "Private key to import from file")
 
-	var address, password string
+	var address, password, token string
+	var clientCert, clientKey, serverCA string
+
+	// clientTLSFlags adds the TLS options of commands talking to the server
+	clientTLSFlags := func(set *flag.FlagSet) {
+		set.StringVar(&clientCert, "cert", "", "TLS client certificate file")
+		set.StringVar(&clientKey, "key", "", "TLS client key file")
+		set.StringVar(&serverCA, "ca", "", "CA file verifying the server certificate")
+	}
+
+	healthcheckFlag = flag.NewFlagSet("healthcheck", flag.ExitOnError)
+	healthcheckFlag.StringVar(&address, "i", "http://localhost:8080", "Server Address")
+	clientTLSFlags(healthcheckFlag)
+
+	var rollout int
+	var overwrite bool
 
 	uploadKeysFlag = flag.NewFlagSet("upload-keys", flag.ExitOnError)
 	uploadKeysFlag.StringVar(&address, "i", "http://localhost:8080", "Server Address")
 	uploadKeysFlag.StringVar(&password, "p", "", "Server Password")
-	uploadKeysFlag.StringVar(&workDir, "w", config.FindAppDataFolder("wpkgup2"), "Server workdir")
+	uploadKeysFlag.StringVar(&token, "t", os.Getenv("WPKGUP_TOKEN"), "API token, used instead of password, defaults to WPKGUP_TOKEN")
+	uploadKeysFlag.StringVar(&workDir, "w", config.DefaultWorkDir(), "Server workdir")
+	clientTLSFlags(uploadKeysFlag)
 
 	signBinaryFlag = flag.NewFlagSet("sign-binary", flag.ExitOnError)
-	signBinaryFlag.StringVar(&workDir, "w", config.FindAppDataFolder("wpkgup2"), "Server workdir")
+	signBinaryFlag.StringVar(&workDir, "w", config.DefaultWorkDir(), "Server workdir")
 
 	uploadBinaryFlag = flag.NewFlagSet("upload-binary", flag.ExitOnError)
 	uploadBinaryFlag.StringVar(&address, "i", "http://localhost:8080", "Server Address")
-	uploadBinaryFlag.StringVar(&workDir, "w", config.FindAppDataFolder("wpkgup2"), "Server workdir")
+	uploadBinaryFlag.StringVar(&workDir, "w", config.DefaultWorkDir(), "Server workdir")
 	uploadBinaryFlag.StringVar(&keyString, "k", "", "Private key to import")
+	uploadBinaryFlag.IntVar(&rollout, "r", 100, "Rollout percentage")
+	uploadBinaryFlag.BoolVar(&overwrite, "f", false, "Overwrite already published version")
+	uploadBinaryFlag.StringVar(&password, "p", "", "Server Password, required to overwrite")
+	uploadBinaryFlag.StringVar(&token, "t", os.Getenv("WPKGUP_TOKEN"), "API token, an admin token can overwrite, defaults to WPKGUP_TOKEN")
+	clientTLSFlags(uploadBinaryFlag)
+
+	setRolloutFlag = flag.NewFlagSet("set-rollout", flag.ExitOnError)
+	setRolloutFlag.StringVar(&address, "i", "http://localhost:8080", "Server Address")
+	setRolloutFlag.StringVar(&password, "p", "", "Server Password")
+	setRolloutFlag.StringVar(&token, "t", os.Getenv("WPKGUP_TOKEN"), "API token, used instead of password, defaults to WPKGUP_TOKEN")
+	clientTLSFlags(setRolloutFlag)
+
+	var shareExpiry time.Duration
+	var shareIp string
+
+	shareFlag = flag.NewFlagSet("share", flag.ExitOnError)
+	shareFlag.StringVar(&address, "i", "http://localhost:8080", "Server Address")
+	shareFlag.StringVar(&password, "p", "", "Server Password")
+	shareFlag.StringVar(&token, "t", os.Getenv("WPKGUP_TOKEN"), "API token, used instead of password, defaults to WPKGUP_TOKEN")
+	shareFlag.DurationVar(&shareExpiry, "e", server.DefaultShareExpiry, "Link expiry")
+	shareFlag.StringVar(&shareIp, "ip", "", "Only allow downloads from this IP address")
+	clientTLSFlags(shareFlag)
+
+	var clearMandatory bool
+
+	setMandatoryFlag = flag.NewFlagSet("set-mandatory", flag.ExitOnError)
+	setMandatoryFlag.StringVar(&address, "i", "http://localhost:8080", "Server Address")
+	setMandatoryFlag.StringVar(&password, "p", "", "Server Password")
+	setMandatoryFlag.StringVar(&token, "t", os.Getenv("WPKGUP_TOKEN"), "API token, used instead of password, defaults to WPKGUP_TOKEN")
+	setMandatoryFlag.BoolVar(&clearMandatory, "clear", false, "Clear mandatory flag")
+	clientTLSFlags(setMandatoryFlag)
+
+	setMinVersionFlag = flag.NewFlagSet("set-min-version", flag.ExitOnError)
+	setMinVersionFlag.StringVar(&address, "i", "http://localhost:8080", "Server Address")
+	setMinVersionFlag.StringVar(&password, "p", "", "Server Password")
+	setMinVersionFlag.StringVar(&token, "t", os.Getenv("WPKGUP_TOKEN"), "API token, used instead of password, defaults to WPKGUP_TOKEN")
+	clientTLSFlags(setMinVersionFlag)
+
+	clearMinVersionFlag = flag.NewFlagSet("clear-min-version", flag.ExitOnError)
+	clearMinVersionFlag.StringVar(&address, "i", "http://localhost:8080", "Server Address")
+	clearMinVersionFlag.StringVar(&password, "p", "", "Server Password")
+	clearMinVersionFlag.StringVar(&token, "t", os.Getenv("WPKGUP_TOKEN"), "API token, used instead of password, defaults to WPKGUP_TOKEN")
+	clientTLSFlags(clearMinVersionFlag)
+
+	var dryRun bool
+	var gcGrace time.Duration
+
+	gcFlag = flag.NewFlagSet("gc", flag.ExitOnError)
+	gcFlag.StringVar(&workDir, "w", config.DefaultWorkDir(), "Server workdir")
+	gcFlag.DurationVar(&gcGrace, "grace", server.DefaultGCGrace, "Keep unreferenced binaries younger than this")
+	gcFlag.BoolVar(&dryRun, "dry-run", false, "Only print binaries which would be removed")
+
+	pruneFlag = flag.NewFlagSet("prune", flag.ExitOnError)
+	pruneFlag.StringVar(&workDir, "w", config.DefaultWorkDir(), "Server workdir")
+	pruneFlag.BoolVar(&dryRun, "dry-run", false, "Only print versions which would be removed")
 
 	println("WpkgUp2", config.Version)
 
@@ -109,16 +247,53 @@ func main() {
 			fmt.Print("Set password: ")
 			password := utils.ScanRequired()
 
-			conf = config.Config{
-				Password: password,
+			err := conf.SetPassword(password)
+			if err != nil {
+				fmt.Println("Failed to hash password:", err)
+				os.Exit(1)
+			}
+			err = config.SavePassword(configFilePath, conf.PasswordHash)
+			if err != nil {
+				fmt.Println("Failed to save config:", err)
+				os.Exit(1)
 			}
-			config.Save(conf, configFilePath)
 
 			fmt.Println("Config created!")
 		} else {
 			fmt.Println("Config already exists in this directory")
 			os.Exit(1)
 		}
+	case "set-password":
+		setPasswordFlag.Parse(os.Args[2:])
+		config.InitDirs(workDir)
+
+		var conf config.Config
+		configFilePath := filepath.Join(workDir, config.ConfigFile)
+		if utils.FileExists(configFilePath) {
+			var err error
+			conf, err = config.Parse(configFilePath)
+			if err != nil {
+				fmt.Println("Failed to load config:", err)
+				os.Exit(1)
+			}
+		}
+
+		if newPassword == "" {
+			fmt.Print("Set password: ")
+			newPassword = utils.ScanRequired()
+		}
+
+		err := conf.SetPassword(newPassword)
+		if err != nil {
+			fmt.Println("Failed to hash password:", err)
+			os.Exit(1)
+		}
+		err = config.SavePassword(configFilePath, conf.PasswordHash)
+		if err != nil {
+			fmt.Println("Failed to save config:", err)
+			os.Exit(1)
+		}
+		fmt.Println("Password updated!")
 	case "server":
 		serverFlag.Parse(os.Args[2:])
 		config.InitDirs(workDir)
@@ -127,31 +302,190 @@ func main() {
 			fmt.Println("Failed to init keystore:", err)
 			os.Exit(1)
 		}
+		err = tokens.Init()
+		if err != nil {
+			fmt.Println("Failed to init tokens:", err)
+			os.Exit(1)
+		}
 
 		var conf config.Config
 		configFilePath := filepath.Join(workDir, config.ConfigFile)
 
-		if !utils.FileExists(configFilePath) {
-			defaultPassword := "1@Qwerty"
+		if !utils.FileExists(configFilePath) && !config.HasEnvPassword() {
+			if !allowDefaultPassword {
+				fmt.Println("Config not detected, run init or set-password to create it or set WPKGUP_PASSWORD")
+				os.Exit(1)
+			}
 
 			fmt.Println("Config not detected, creating default config...")
-			fmt.Println("Default password is \"" + defaultPassword + "\", remember to change it later.")
-			conf = config.Config{
-				Password: defaultPassword,
+			fmt.Println("Default password is \"" + config.DefaultPassword + "\", remember to change it later.")
+			err := conf.SetPassword(config.DefaultPassword)
+			if err != nil {
+				fmt.Println("Failed to hash password:", err)
+				os.Exit(1)
 			}
-			err := config.Save(conf, configFilePath)
+			err = config.SavePassword(configFilePath, conf.PasswordHash)
 			if err != nil {
 				fmt.Println("Failed to save config")
 				os.Exit(1)
 			}
 		}
 
+		if conf, err := config.Parse(configFilePath); err == nil && conf.Password != "" {
+			fmt.Println("Replacing plain text password in config with a hash...")
+			err := conf.SetPassword(conf.Password)
+			if err == nil {
+				err = config.SavePassword(configFilePath, conf.PasswordHash)
+			}
+			if err != nil {
+				fmt.Println("Failed to hash password:", err)
+				os.Exit(1)
+			}
+		}
+
+		//flags take precedence over the config file and environment
+		config.SetOverride(func(conf *config.Config) {
+			serverFlag.Visit(func(f *flag.Flag) {
+				switch f.Name {
+				case "i", "p":
+					conf.Server.Listen = []string{net.JoinHostPort(serverIp, strconv.Itoa(serverPort))}
+				case "tls-cert":
+					conf.TLS.CertFile = tlsCert
+				case "tls-key":
+					conf.TLS.KeyFile = tlsKey
+				case "tls-redirect":
+					conf.TLS.RedirectAddress = tlsRedirect
+				}
+			})
+		})
 		err = config.Init()
 		if err != nil {
-			fmt.Println("Failed to load config")
+			fmt.Println("Failed to load config:", err)
+			os.Exit(1)
+		}
+
+		if errs := config.Current().Validate(); len(errs) > 0 {
+			for _, err := range errs {
+				fmt.Println("Invalid config:", err)
+			}
+			os.Exit(1)
+		}
+		if config.Current().CheckPassword(config.DefaultPassword) && !allowDefaultPassword {
+			fmt.Println("Refusing to start with the default password, use set-password to change it")
+			os.Exit(1)
+		}
+		err = storage.Init()
+		if err != nil {
+			fmt.Println("Failed to init storage:", err)
+			os.Exit(1)
+		}
+		err = server.InitShareKey()
+		if err != nil {
+			fmt.Println("Failed to init share key:", err)
+			os.Exit(1)
+		}
+		server.StartServer()
+	case "config":
+		if len(os.Args) < 3 || os.Args[2] != "validate" {
+			fmt.Fprintln(os.Stderr, "Expected config validate")
+			os.Exit(1)
+		}
+		configFlag.Parse(os.Args[3:])
+
+		configFilePath := configFile
+		if configFilePath == "" {
+			configFilePath = filepath.Join(workDir, config.ConfigFile)
+		}
+
+		conf, unknown, err := config.ParseStrict(configFilePath)
+		if err != nil {
+			fmt.Println("Failed to parse config:", err)
+			os.Exit(1)
+		}
+		for _, key := range unknown {
+			fmt.Println("Unknown key:", key)
+		}
+
+		var errs []error
+		if err := conf.ApplyEnv(); err != nil {
+			errs = append(errs, err)
+		}
+		errs = append(errs, conf.Validate()...)
+		for _, err := range errs {
+			fmt.Println("Invalid value:", err)
+		}
+
+		if len(unknown) > 0 || len(errs) > 0 {
+			os.Exit(1)
+		}
+		fmt.Println("Config is valid")
+	case "token":
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, "Missing argument")
+			break
+		}
+
+		var name string
+		args := os.Args[3:]
+		if os.Args[2] == "create" || os.Args[2] == "revoke" {
+			if len(os.Args) < 4 {
+				fmt.Fprintln(os.Stderr, "Missing argument")
+				break
+			}
+			name = os.Args[3]
+			args = os.Args[4:]
+		}
+		tokenFlag.Parse(args)
+		config.InitDirs(workDir)
+
+		err := tokens.Init()
+		if err != nil {
+			fmt.Println("Failed to init tokens:", err)
+			os.Exit(1)
+		}
+
+		switch os.Args[2] {
+		case "create":
+			if _, err := server.ParseIdent(name); err != nil {
+				fmt.Println("Invalid token name:", err)
+				os.Exit(1)
+			}
+			role, err := tokens.ParseRole(tokenRole)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			secret, err := tokens.Create(name, role)
+			if err != nil {
+				fmt.Println("Failed to create token:", err)
+				os.Exit(1)
+			}
+			fmt.Println("Token " + name + " (" + string(role) + ") created, it will not be shown again:")
+			fmt.Println(secret)
+		case "list":
+			list, err := tokens.List()
+			if err != nil {
+				fmt.Println("Failed to list tokens:", err)
+				os.Exit(1)
+			}
+			for _, t := range list {
+				status := "active"
+				if t.Revoked != nil {
+					status = "revoked " + t.Revoked.Format(time.RFC3339)
+				}
+				fmt.Println(t.Name, t.Role, "created", t.Created.Format(time.RFC3339), status)
+			}
+		case "revoke":
+			err := tokens.Revoke(name)
+			if err != nil {
+				fmt.Println("Failed to revoke token:", err)
+				os.Exit(1)
+			}
+			fmt.Println("Token " + name + " revoked")
+		default:
+			fmt.Fprintln(os.Stderr, "Unknown token command:", os.Args[2])
 			os.Exit(1)
 		}
-		server.StartServer(serverIp, serverPort)
 	case "gen-keys":
 		genFlag.Parse(os.Args[2:])
 		config.InitDirs(workDir)
@@ -187,12 +521,13 @@ func main() {
 		uploadKeysFlag.Parse(os.Args[2:])
 		config.InitDirs(workDir)
 
-		if password == "" {
-			fmt.Print("Enter server password: ")
-			password = utils.ScanRequired()
+		err := client.UseTLS(clientCert, clientKey, serverCA)
+		if err != nil {
+			fmt.Println("TLS error:", err)
+			os.Exit(1)
 		}
 
-		err := client.UploadKey(address, password)
+		err = client.UploadKey(address, credentials(token, password, clientCert))
 		if err != nil {
 			fmt.Println(err)
 			os.Exit(1)
@@ -237,6 +572,12 @@ func main() {
 		}
 		config.InitDirs(workDir)
 
+		err := client.UseTLS(clientCert, clientKey, serverCA)
+		if err != nil {
+			fmt.Println("TLS error:", err)
+			os.Exit(1)
+		}
+
 		component := os.Args[2]
 		channel := os.Args[3]
 		Os := os.Args[4]
@@ -245,7 +586,6 @@ func main() {
 		filename := os.Args[7]
 
 		var privateKey *ecdsa.PrivateKey
-		var err error
 
 		if keyString != "" {
 			privateKey, err = crypto.ParsePrivateKeyFromString(keyString)
@@ -257,13 +597,237 @@ func main() {
 			os.Exit(1)
 		}
 
+		creds := client.Credentials{Token: token}
+		if overwrite {
+			creds = credentials(token, password, clientCert)
+		}
+
 		fmt.Println("Uploading binary...")
-		err = client.UploadBinary(component, channel, Os, arch, version, address, filename, privateKey)
+		err = client.UploadBinary(component, channel, Os, arch, version, address, filename, rollout, overwrite, creds, privateKey)
 		if err != nil {
 			fmt.Println(err)
 			os.Exit(1)
 		}
 		fmt.Println("Binary uploaded successfully!")
+	case "set-rollout":
+		if len(os.Args) > 8 {
+			setRolloutFlag.Parse(os.Args[8:])
+		}
+		if len(os.Args) < 8 {
+			fmt.Fprintln(os.Stderr, "Missing argument")
+			break
+		}
+
+		err := client.UseTLS(clientCert, clientKey, serverCA)
+		if err != nil {
+			fmt.Println("TLS error:", err)
+			os.Exit(1)
+		}
+
+		component := os.Args[2]
+		channel := os.Args[3]
+		Os := os.Args[4]
+		arch := os.Args[5]
+		version := os.Args[6]
+		percentage, err := strconv.Atoi(os.Args[7])
+		if err != nil {
+			fmt.Println("Invalid rollout percentage:", os.Args[7])
+			os.Exit(1)
+		}
+
+		err = client.SetRollout(component, channel, Os, arch, version, address, credentials(token, password, clientCert), percentage)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println("Rollout set to " + os.Args[7] + "%")
+	case "healthcheck":
+		healthcheckFlag.Parse(os.Args[2:])
+
+		err := client.UseTLS(clientCert, clientKey, serverCA)
+		if err != nil {
+			fmt.Println("TLS error:", err)
+			os.Exit(1)
+		}
+
+		err = client.Ready(address)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println("Server is ready")
+	case "share":
+		if len(os.Args) > 7 {
+			shareFlag.Parse(os.Args[7:])
+		}
+		if len(os.Args) < 7 {
+			fmt.Fprintln(os.Stderr, "Missing argument")
+			break
+		}
+
+		err := client.UseTLS(clientCert, clientKey, serverCA)
+		if err != nil {
+			fmt.Println("TLS error:", err)
+			os.Exit(1)
+		}
+
+		component := os.Args[2]
+		channel := os.Args[3]
+		Os := os.Args[4]
+		arch := os.Args[5]
+		version := os.Args[6]
+
+		link, err := client.ShareBinary(component, channel, Os, arch, version, address, credentials(token, password, clientCert), shareExpiry, shareIp)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println(link)
+	case "set-mandatory":
+		if len(os.Args) > 7 {
+			setMandatoryFlag.Parse(os.Args[7:])
+		}
+		if len(os.Args) < 7 {
+			fmt.Fprintln(os.Stderr, "Missing argument")
+			break
+		}
+
+		err := client.UseTLS(clientCert, clientKey, serverCA)
+		if err != nil {
+			fmt.Println("TLS error:", err)
+			os.Exit(1)
+		}
+
+		component := os.Args[2]
+		channel := os.Args[3]
+		Os := os.Args[4]
+		arch := os.Args[5]
+		version := os.Args[6]
+
+		err = client.SetMandatory(component, channel, Os, arch, version, address, credentials(token, password, clientCert), !clearMandatory)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if clearMandatory {
+			fmt.Println("Version " + version + " is no longer mandatory")
+		} else {
+			fmt.Println("Version " + version + " marked as mandatory")
+		}
+	case "set-min-version":
+		if len(os.Args) > 5 {
+			setMinVersionFlag.Parse(os.Args[5:])
+		}
+		if len(os.Args) < 5 {
+			fmt.Fprintln(os.Stderr, "Missing argument")
+			break
+		}
+
+		err := client.UseTLS(clientCert, clientKey, serverCA)
+		if err != nil {
+			fmt.Println("TLS error:", err)
+			os.Exit(1)
+		}
+
+		component := os.Args[2]
+		channel := os.Args[3]
+		version := os.Args[4]
+
+		err = client.SetMinimumVersion(component, channel, version, address, credentials(token, password, clientCert))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println("Minimum version set to " + version)
+	case "clear-min-version":
+		if len(os.Args) > 4 {
+			clearMinVersionFlag.Parse(os.Args[4:])
+		}
+		if len(os.Args) < 4 {
+			fmt.Fprintln(os.Stderr, "Missing argument")
+			break
+		}
+
+		err := client.UseTLS(clientCert, clientKey, serverCA)
+		if err != nil {
+			fmt.Println("TLS error:", err)
+			os.Exit(1)
+		}
+
+		component := os.Args[2]
+		channel := os.Args[3]
+
+		err = client.ClearMinimumVersion(component, channel, address, credentials(token, password, clientCert))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println("Minimum version cleared")
+	case "gc":
+		gcFlag.Parse(os.Args[2:])
+		config.InitDirs(workDir)
+
+		err := config.Init()
+		if err != nil {
+			fmt.Println("Failed to load config")
+			os.Exit(1)
+		}
+		err = storage.Init()
+		if err != nil {
+			fmt.Println("Failed to init storage:", err)
+			os.Exit(1)
+		}
+
+		removed, err := server.CollectGarbage(gcGrace, dryRun)
+		var freed int64
+		for _, blob := range removed {
+			freed += blob.Size
+			if dryRun {
+				fmt.Println("Would remove", blob.Checksum, blob.Size, "bytes")
+			} else {
+				fmt.Println("Removed", blob.Checksum, blob.Size, "bytes")
+			}
+		}
+		if err != nil {
+			fmt.Println("Garbage collection failed:", err)
+			os.Exit(1)
+		}
+		fmt.Println(len(removed), "binaries,", freed, "bytes freed")
+	case "prune":
+		pruneFlag.Parse(os.Args[2:])
+		config.InitDirs(workDir)
+
+		err := config.Init()
+		if err != nil {
+			fmt.Println("Failed to load config")
+			os.Exit(1)
+		}
+		err = storage.Init()
+		if err != nil {
+			fmt.Println("Failed to init storage:", err)
+			os.Exit(1)
+		}
+
+		pruned, err := server.Prune(dryRun)
+		for _, version := range pruned {
+			action := "Removed"
+			if dryRun {
+				action = "Would remove"
+			}
+			fmt.Println(action, version.Component, version.Channel, version.Os, version.Arch, version.Version, "published", version.Published.Format(time.RFC3339), "("+version.Reason+")")
+		}
+		if err != nil {
+			fmt.Println("Prune failed:", err)
+			os.Exit(1)
+		}
+		if dryRun {
+			fmt.Println(len(pruned), "versions would be pruned")
+		} else {
+			fmt.Println(len(pruned), "versions pruned")
+		}
+		if !dryRun && len(pruned) > 0 {
+			fmt.Println("Run gc to remove binaries which are no longer referenced")
+		}
 	case "--help":
 		help(os.Args[0])
 	}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"wpkg.dev/wpkgup/config"
+	"wpkg.dev/wpkgup/tokens"
+)
+
+const callerKey = "caller"
+
+// identity is the authenticated caller of a request
+type identity struct {
+	Name string
+	Role tokens.Role
+	// Components limits the identity to these components, empty allows all
+	Components []string
+}
+
+func (i identity) allowsComponent(component string) bool {
+	if len(i.Components) == 0 || component == "" {
+		return true
+	}
+	for _, allowed := range i.Components {
+		if allowed == component {
+			return true
+		}
+	}
+	return false
+}
+
+// bearerToken returns the token of the Authorization header
+func bearerToken(c *gin.Context) (string, bool) {
+	header := c.GetHeader("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(header[7:]), true
+}
+
+// clientCertificate returns the subject of a verified TLS client certificate
+func clientCertificate(c *gin.Context) (string, bool) {
+	state := c.Request.TLS
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	return state.VerifiedChains[0][0].Subject.String(), true
+}
+
+// hasCredentials reports whether the request carries any kind of credentials
+func hasCredentials(c *gin.Context) bool {
+	_, bearer := bearerToken(c)
+	_, cert := clientCertificate(c)
+	return bearer || cert || c.GetHeader("Password") != ""
+}
+
+var errInvalidCredentials = errors.New("Invalid credentials")
+
+// credentials returns the caller of a request from a bearer token, the admin
+// password or a client certificate, in this order. A request without
+// credentials has no caller.
+func credentials(c *gin.Context) (identity, error) {
+	if secret, ok := bearerToken(c); ok {
+		token, ok := tokens.Authenticate(secret)
+		if !ok {
+			return identity{}, errInvalidCredentials
+		}
+		return identity{Name: "token " + token.Name, Role: token.Role}, nil
+	}
+
+	if password := c.GetHeader("Password"); password != "" {
+		if !config.Current().CheckPassword(password) {
+			return identity{}, errInvalidCredentials
+		}
+		return identity{Name: "admin password", Role: tokens.RoleAdmin}, nil
+	}
+
+	if subject, ok := clientCertificate(c); ok {
+		conf, ok := config.Current().ClientCerts[subject]
+		if !ok {
+			reqLog(c).Warn("unknown client certificate", "subject", subject)
+			return identity{}, errInvalidCredentials
+		}
+		role, err := tokens.ParseRole(conf.Role)
+		if err != nil {
+			reqLog(c).Warn("invalid client certificate config", "subject", subject, "error", err)
+			return identity{}, errInvalidCredentials
+		}
+		name := conf.Name
+		if name == "" {
+			name = subject
+		}
+		return identity{Name: "certificate " + name, Role: role, Components: conf.Components}, nil
+	}
+	return identity{}, nil
+}
+
+// authorize accepts credentials granting role for the component of the
+// request, the name of the caller is kept for logging
+func authorize(c *gin.Context, role tokens.Role) bool {
+	return authorizeComponent(c, role, c.Param("component"))
+}
+
+func authorizeComponent(c *gin.Context, role tokens.Role, component string) bool {
+	caller, err := credentials(c)
+	if err != nil || caller.Name == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errInvalidCredentials.Error()})
+		return false
+	}
+	if !caller.Role.Allows(role) {
+		reqLog(c).Warn("access denied", "caller", caller.Name, "role", string(caller.Role), "method", c.Request.Method, "path", c.Request.URL.Path)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Role " + string(caller.Role) + " is not allowed to do this"})
+		return false
+	}
+	if !caller.allowsComponent(component) {
+		reqLog(c).Warn("access denied", "caller", caller.Name, "method", c.Request.Method, "path", c.Request.URL.Path)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed to access component " + component})
+		return false
+	}
+	c.Set(callerKey, caller.Name)
+	return true
+}
+
+// canRead reports whether the identity may read private channels of component
+func (i identity) canRead(component string) bool {
+	return i.Name != "" && i.Role.Allows(tokens.RoleReader) && i.allowsComponent(component)
+}
+
+// authorizeRead requires a reader token for private channels, channel ""
+// checks the component only
+func authorizeRead(c *gin.Context, component, channel string) bool {
+	if !config.Current().IsPrivate(component, channel) {
+		return true
+	}
+	return authorizeComponent(c, tokens.RoleReader, component)
+}
+
+// caller names who made an authorized request
+func caller(c *gin.Context) string {
+	if name := c.GetString(callerKey); name != "" {
+		return name
+	}
+	return "anonymous"
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"path"
+	"time"
+
+	"wpkg.dev/wpkgup/storage"
+)
+
+// BlobDir holds binaries and signatures addressed by their SHA-256 checksum, so
+// identical binaries published to several versions, channels or arches are
+// stored once and a release switches to a new binary and signature at once
+const BlobDir = ".blobs"
+
+// DefaultGCGrace is how long unreferenced blobs are kept by default
+const DefaultGCGrace = time.Hour
+
+type Blob struct {
+	Checksum string
+	Size     int64
+	ModTime  time.Time
+	// Refs is the number of version.json files referencing the blob
+	Refs int
+}
+
+func BlobPath(checksum string) string {
+	return storage.Join(BlobDir, checksum[:2], checksum)
+}
+
+// PutBlob stores the local file src in the blob store. Blobs which already
+// exist are written again, refreshing their modification time so that a
+// concurrently running gc can't collect them before they are referenced.
+func PutBlob(src, checksum string) error {
+	return putFile(BlobPath(checksum), src)
+}
+
+// BlobRefCounts counts references to blobs from all version.json files
+func BlobRefCounts() (map[string]int, error) {
+	refs := map[string]int{}
+	return refs, countBlobRefs("", refs)
+}
+
+func countBlobRefs(dir string, refs map[string]int) error {
+	entries, err := storage.Default.List(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		p := storage.Join(dir, entry.Name)
+		if entry.IsDir {
+			if p == BlobDir {
+				continue
+			}
+			if err := countBlobRefs(p, refs); err != nil {
+				return err
+			}
+			continue
+		}
+		if entry.Name != "version.json" {
+			continue
+		}
+
+		release, err := ReadVersionJson(p)
+		if err != nil {
+			return err
+		}
+		for _, blob := range []string{release.Blob, release.Signature} {
+			if blob != "" {
+				refs[blob]++
+			}
+		}
+		if release.Previous != nil {
+			for _, blob := range []string{release.Previous.Blob, release.Previous.Signature} {
+				if blob != "" {
+					refs[blob]++
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ListBlobs returns all blobs with their reference counts
+func ListBlobs() ([]Blob, error) {
+	refs, err := BlobRefCounts()
+	if err != nil {
+		return nil, err
+	}
+
+	prefixes, err := storage.Default.List(BlobDir)
+	if err != nil {
+		if !storage.Exists(storage.Default, BlobDir) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var blobs []Blob
+	for _, prefix := range prefixes {
+		if !prefix.IsDir {
+			continue
+		}
+		entries, err := storage.Default.List(storage.Join(BlobDir, prefix.Name))
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.IsDir {
+				continue
+			}
+			blobs = append(blobs, Blob{
+				Checksum: entry.Name,
+				Size:     entry.Size,
+				ModTime:  entry.ModTime,
+				Refs:     refs[entry.Name],
+			})
+		}
+	}
+	return blobs, nil
+}
+
+// CollectGarbage removes blobs which aren't referenced by any version. Blobs
+// younger than grace are kept, as they may belong to an upload in progress.
+func CollectGarbage(grace time.Duration, dryRun bool) ([]Blob, error) {
+	blobs, err := ListBlobs()
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []Blob
+	for _, blob := range blobs {
+		if blob.Refs > 0 || time.Since(blob.ModTime) < grace {
+			continue
+		}
+		if !dryRun {
+			if err := storage.Default.Delete(BlobPath(blob.Checksum)); err != nil {
+				return removed, err
+			}
+		}
+		removed = append(removed, blob)
+	}
+	return removed, nil
+}
+
+// blobRelease returns the release of a version directory if its binary is
+// kept in the blob store
+func blobRelease(dir string) (VersionJson, bool) {
+	release, err := ReadVersionJson(storage.Join(dir, "version.json"))
+	if err != nil || release.Blob == "" || storage.Join(path.Dir(release.Path)) != storage.Join(dir) {
+		return VersionJson{}, false
+	}
+	return release, true
+}
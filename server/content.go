@@ -0,0 +1,46 @@
+package server
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"wpkg.dev/wpkgup/storage"
+	"wpkg.dev/wpkgup/utils"
+)
+
+// serveContent sends a file from the storage backend as name, supporting
+// range requests
+func serveContent(c *gin.Context, path, name string) error {
+	f, err := storage.Open(storage.Default, path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	head, err := storage.Default.Get(path, 0, 3072)
+	if err != nil {
+		return err
+	}
+	mime, err := utils.GetMimeTypeFromReader(head)
+	head.Close()
+	if err != nil {
+		return err
+	}
+
+	info := f.Stat()
+	c.Header("Content-Type", mime)
+	http.ServeContent(c.Writer, c.Request, name, info.ModTime, f)
+	return nil
+}
+
+// putFile copies a local file into the storage backend
+func putFile(dest, src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return storage.Default.Put(dest, f)
+}
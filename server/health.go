@@ -0,0 +1,98 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"wpkg.dev/wpkgup/config"
+	"wpkg.dev/wpkgup/keystore"
+	"wpkg.dev/wpkgup/storage"
+)
+
+// readyCheckTimeout limits every readiness check, so an unreachable storage
+// backend fails the check instead of blocking the probe
+const readyCheckTimeout = 5 * time.Second
+
+var errCheckTimeout = errors.New("timed out")
+
+// Healthz reports that the process is alive and serving requests
+func Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz reports whether the server can serve and publish releases, along with
+// the result of every check
+func Readyz(c *gin.Context) {
+	checks := map[string]func() error{
+		"workdir":  checkWorkDir,
+		"config":   checkConfig,
+		"keystore": checkKeystore,
+		"storage":  checkStorage,
+	}
+
+	status := http.StatusOK
+	results := gin.H{}
+	for name, check := range checks {
+		err := runCheck(check)
+		if err != nil {
+			reqLog(c).Warn("readiness check failed", "check", name, "error", err)
+			status = http.StatusServiceUnavailable
+			results[name] = err.Error()
+			continue
+		}
+		results[name] = "ok"
+	}
+
+	result := "ready"
+	if status != http.StatusOK {
+		result = "not ready"
+	}
+	c.JSON(status, gin.H{"status": result, "checks": results})
+}
+
+func runCheck(check func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- check()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(readyCheckTimeout):
+		return errCheckTimeout
+	}
+}
+
+func checkWorkDir() error {
+	file, err := os.CreateTemp(config.WorkDir, ".readyz-*")
+	if err != nil {
+		return err
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
+
+func checkConfig() error {
+	if !config.Loaded() {
+		return errors.New("not loaded")
+	}
+	return nil
+}
+
+func checkKeystore() error {
+	if !keystore.Loaded() {
+		return errors.New("not loaded")
+	}
+	return nil
+}
+
+func checkStorage() error {
+	if storage.Default == nil {
+		return errors.New("not initialized")
+	}
+	_, err := storage.Default.Stat("")
+	return err
+}
@@ -0,0 +1,30 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadyz(t *testing.T) {
+	r, _, _ := newTestServer(t)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	var body struct {
+		Status string
+		Checks map[string]string
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK {
+		t.Errorf("readyz answered %d: %+v", w.Code, body)
+	}
+	for _, check := range []string{"config", "keystore", "storage", "workdir"} {
+		if body.Checks[check] != "ok" {
+			t.Errorf("check %s = %q, want ok", check, body.Checks[check])
+		}
+	}
+}
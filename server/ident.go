@@ -0,0 +1,66 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Ident is a validated path segment, like a component, channel, os, arch,
+// version or file name. It can't contain separators or refer to a parent or
+// hidden directory.
+type Ident string
+
+var identPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+-]*$`)
+
+const maxIdentLength = 128
+
+func ParseIdent(s string) (Ident, error) {
+	if len(s) == 0 || len(s) > maxIdentLength {
+		return "", fmt.Errorf("length must be between 1 and %d", maxIdentLength)
+	}
+	if !identPattern.MatchString(s) || strings.Contains(s, "..") {
+		return "", fmt.Errorf("%q contains disallowed characters", s)
+	}
+	return Ident(s), nil
+}
+
+// ParseIdentPath validates every segment of a slash separated path
+func ParseIdentPath(p string) ([]Ident, error) {
+	var idents []Ident
+	for _, segment := range strings.Split(p, "/") {
+		if segment == "" {
+			continue
+		}
+		ident, err := ParseIdent(segment)
+		if err != nil {
+			return nil, err
+		}
+		idents = append(idents, ident)
+	}
+	return idents, nil
+}
+
+func invalidParameter(c *gin.Context, name string, err error) {
+	c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "INVALID_PARAMETER", "message": "invalid " + name + ": " + err.Error()})
+}
+
+// ValidateParams rejects requests whose route parameters aren't valid idents
+func ValidateParams(c *gin.Context) {
+	for _, param := range c.Params {
+		var err error
+		if param.Key == "content" {
+			_, err = ParseIdentPath(param.Value)
+		} else {
+			_, err = ParseIdent(param.Value)
+		}
+		if err != nil {
+			invalidParameter(c, param.Key, err)
+			return
+		}
+	}
+	c.Next()
+}
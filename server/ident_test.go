@@ -0,0 +1,244 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"wpkg.dev/wpkgup/storage"
+)
+
+var identSeeds = []string{
+	"app", "1.0.0", "1.0.0+build.1", "linux", "amd64",
+	"", ".", "..", ".blobs", ".hidden", "a/b", "/", "a\\b", "..\\..",
+	"%2e%2e", "%2E%2E", "%2f", "a%2fb", "a..b", "-a", "a\x00b", "a b", "ä",
+	strings.Repeat("a", maxIdentLength+1),
+}
+
+// checkIdent fails if ident could address anything else than a single visible
+// entry below its parent directory
+func checkIdent(t *testing.T, s string, ident Ident) {
+	if string(ident) != s {
+		t.Fatalf("ParseIdent(%q) = %q", s, ident)
+	}
+	if s == "" || len(s) > maxIdentLength {
+		t.Fatalf("ParseIdent accepted %q with length %d", s, len(s))
+	}
+	if strings.HasPrefix(s, ".") || strings.Contains(s, "..") {
+		t.Fatalf("ParseIdent accepted hidden or parent name %q", s)
+	}
+	if strings.ContainsAny(s, "/\\%\x00") {
+		t.Fatalf("ParseIdent accepted separator or escape in %q", s)
+	}
+	if storage.Join("dir", s) != "dir/"+s {
+		t.Fatalf("ParseIdent accepted %q which doesn't join as one segment", s)
+	}
+}
+
+func FuzzParseIdent(f *testing.F) {
+	for _, seed := range identSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		ident, err := ParseIdent(s)
+		if err != nil {
+			return
+		}
+		checkIdent(t, s, ident)
+	})
+}
+
+func FuzzParseIdentPath(f *testing.F) {
+	for _, seed := range identSeeds {
+		f.Add(seed)
+		f.Add("dir/" + seed + "/file")
+	}
+	f.Add("/a//b/")
+	f.Fuzz(func(t *testing.T, p string) {
+		idents, err := ParseIdentPath(p)
+		if err != nil {
+			return
+		}
+		var segments []string
+		for _, segment := range strings.Split(p, "/") {
+			if segment != "" {
+				segments = append(segments, segment)
+			}
+		}
+		if len(idents) != len(segments) {
+			t.Fatalf("ParseIdentPath(%q) returned %d idents for %d segments", p, len(idents), len(segments))
+		}
+		for i, ident := range idents {
+			checkIdent(t, segments[i], ident)
+		}
+	})
+}
+
+// recordingBackend records the paths of every call made to the backend
+type recordingBackend struct {
+	storage.Backend
+	mu    sync.Mutex
+	paths []string
+}
+
+func (b *recordingBackend) record(paths ...string) {
+	b.mu.Lock()
+	b.paths = append(b.paths, paths...)
+	b.mu.Unlock()
+}
+
+func (b *recordingBackend) reset() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	paths := b.paths
+	b.paths = nil
+	return paths
+}
+
+func (b *recordingBackend) Put(path string, r io.Reader) error {
+	b.record(path)
+	return b.Backend.Put(path, r)
+}
+
+func (b *recordingBackend) Get(path string, offset, length int64) (io.ReadCloser, error) {
+	b.record(path)
+	return b.Backend.Get(path, offset, length)
+}
+
+func (b *recordingBackend) Stat(path string) (storage.FileInfo, error) {
+	b.record(path)
+	return b.Backend.Stat(path)
+}
+
+func (b *recordingBackend) List(path string) ([]storage.FileInfo, error) {
+	b.record(path)
+	return b.Backend.List(path)
+}
+
+func (b *recordingBackend) Delete(path string) error {
+	b.record(path)
+	return b.Backend.Delete(path)
+}
+
+// routeTemplates are the routes taking idents, every {} is replaced by the
+// fuzzed value once while the other parameters stay valid
+var routeTemplates = []struct {
+	method string
+	path   string
+	// files routes take a slash separated path
+	files bool
+}{
+	{"GET", "/api/{}/{}/{}/{}/json", false},
+	{"GET", "/api/{}/{}/{}/{}/{}/getbinary", false},
+	{"POST", "/api/{}/{}/{}/{}/{}/uploadbinary", false},
+	{"PUT", "/api/{}/{}/{}/{}/{}/rollout", false},
+	{"PUT", "/api/{}/{}/{}/{}/{}/mandatory", false},
+	{"POST", "/api/{}/{}/{}/{}/{}/share", false},
+	{"PUT", "/api/{}/{}/minversion", false},
+	{"DELETE", "/api/{}/{}/minversion", false},
+	{"GET", "/files/{}", true},
+	{"GET", "/files/app/{}/app.bin", true},
+}
+
+var validParams = []string{"app", "stable", "linux", "amd64", "1.0.0"}
+
+// routePaths returns the paths of template with each parameter replaced by
+// segment in turn
+func routePaths(template, segment string) []string {
+	count := strings.Count(template, "{}")
+	var paths []string
+	for i := 0; i < count; i++ {
+		path := template
+		for j := 0; j < count; j++ {
+			value := validParams[j]
+			if j == i {
+				value = segment
+			}
+			path = strings.Replace(path, "{}", value, 1)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// rejects reports whether the escaped segment is invalid as a parameter, an
+// escaped separator is a valid separator in a files path
+func rejects(files bool, segment string) bool {
+	value, err := url.PathUnescape(segment)
+	if err != nil {
+		return true
+	}
+	if files {
+		_, err = ParseIdentPath(value)
+	} else {
+		_, err = ParseIdent(value)
+	}
+	return err != nil
+}
+
+func newRecordingServer(t testing.TB) (http.Handler, *recordingBackend) {
+	r, memory, _ := newTestServer(t)
+	recorder := &recordingBackend{Backend: memory}
+	storage.Default = recorder
+	return r, recorder
+}
+
+// checkRejected sends method path and fails unless it is answered with 400
+// before storage is accessed
+func checkRejected(t *testing.T, r http.Handler, recorder *recordingBackend, method, path string) {
+	t.Helper()
+	req := httptest.NewRequest(method, "/", nil)
+	req.URL = &url.URL{Path: path, RawPath: path}
+	if unescaped, err := url.PathUnescape(path); err == nil {
+		req.URL.Path = unescaped
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("%s %s answered %d, want 400", method, path, w.Code)
+	}
+	if paths := recorder.reset(); len(paths) > 0 {
+		t.Errorf("%s %s accessed storage at %q", method, path, paths)
+	}
+}
+
+func TestRoutesRejectInvalidParams(t *testing.T) {
+	r, recorder := newRecordingServer(t)
+	segments := []string{"..", ".", ".blobs", ".hidden", "%2e%2e", "%2E%2E", ".%2e", "a%2fb", "%2f", "a%5cb", "%2e%2e%2f%2e%2e", "%2eblobs"}
+	for _, route := range routeTemplates {
+		for _, segment := range segments {
+			if !rejects(route.files, segment) {
+				continue
+			}
+			for _, path := range routePaths(route.path, segment) {
+				checkRejected(t, r, recorder, route.method, path)
+			}
+		}
+	}
+}
+
+func FuzzRoutes(f *testing.F) {
+	for _, seed := range identSeeds {
+		f.Add(seed)
+	}
+	r, recorder := newRecordingServer(f)
+	f.Fuzz(func(t *testing.T, segment string) {
+		escaped := url.PathEscape(segment)
+		if escaped == "" {
+			// an empty segment doesn't match a route
+			return
+		}
+		for _, route := range routeTemplates {
+			if !rejects(route.files, escaped) {
+				continue
+			}
+			for _, path := range routePaths(route.path, escaped) {
+				checkRejected(t, r, recorder, route.method, path)
+			}
+		}
+	})
+}
@@ -1,26 +1,160 @@
 package server
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"strconv"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"wpkg.dev/wpkgup/config"
+	"wpkg.dev/wpkgup/logging"
 )
 
-func StartServer(ip string, port int) {
-	r := gin.Default()
+// StartServer serves on all listen addresses of the config until the server
+// is shut down
+func StartServer() {
+	conf := config.Current()
+
+	var logOutput io.Writer = os.Stderr
+	if conf.Log.File != "" {
+		logFile, err := os.OpenFile(conf.Log.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0664)
+		if err != nil {
+			fmt.Println("Failed to open log file:", err)
+			os.Exit(1)
+		}
+		logOutput = logFile
+		gin.DefaultWriter = logFile
+		gin.DefaultErrorWriter = logFile
+	}
+	level, err := logging.ParseLevel(conf.Log.Level)
+	if err != nil {
+		fmt.Println("Invalid log level:", err)
+		os.Exit(1)
+	}
+	logger, err := logging.New(logOutput, level, conf.Log.Format)
+	if err != nil {
+		fmt.Println("Invalid log format:", err)
+		os.Exit(1)
+	}
+	logging.SetDefault(logger)
+
+	r := gin.New()
+	r.Use(gin.Recovery())
+	err = r.SetTrustedProxies(conf.Server.TrustedProxies)
+	if err != nil {
+		fmt.Println("Invalid trusted proxies:", err)
+		os.Exit(1)
+	}
 	InitControllers(r)
-	fmt.Println("Starting HTTP Server at http://" + ip + ":" + strconv.Itoa(port))
-	r.Run(ip + ":" + strconv.Itoa(port))
+	removeOrphanedTempDirs()
+	go runPruner()
+	go watchReload()
+
+	var tlsConfig *tls.Config
+	scheme := "http"
+	if conf.TLS.Enabled() {
+		reloader, err := newCertReloader(conf.TLS)
+		if err != nil {
+			fmt.Println("Failed to load certificates:", err)
+			os.Exit(1)
+		}
+		tlsConfig, err = reloader.tlsConfig()
+		if err != nil {
+			fmt.Println("Invalid TLS config:", err)
+			os.Exit(1)
+		}
+		go reloader.watch()
+		scheme = "https"
+	}
+
+	var servers []*http.Server
+	for _, addr := range conf.Server.Listen {
+		servers = append(servers, &http.Server{
+			Addr:              addr,
+			Handler:           r,
+			TLSConfig:         tlsConfig,
+			ReadHeaderTimeout: time.Duration(conf.Server.ReadHeaderTimeout),
+			ReadTimeout:       time.Duration(conf.Server.ReadTimeout),
+			WriteTimeout:      time.Duration(conf.Server.WriteTimeout),
+			IdleTimeout:       time.Duration(conf.Server.IdleTimeout),
+			MaxHeaderBytes:    int(conf.Server.MaxHeaderBytes),
+		})
+	}
+
+	var redirect *http.Server
+	if tlsConfig != nil && conf.TLS.RedirectAddress != "" {
+		_, port, _ := net.SplitHostPort(conf.Server.Listen[0])
+		redirect = &http.Server{
+			Addr:              conf.TLS.RedirectAddress,
+			Handler:           redirectHandler(port),
+			ReadHeaderTimeout: time.Duration(conf.Server.ReadHeaderTimeout),
+		}
+	}
+
+	if redirect != nil {
+		fmt.Println("Redirecting HTTP requests from " + redirect.Addr)
+		go func() {
+			err := redirect.ListenAndServe()
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logging.Default().Error("redirect server failed", "error", err)
+			}
+		}()
+		servers = append(servers, redirect)
+	}
+	done := shutdownOnSignal(servers...)
+
+	for _, srv := range servers {
+		if srv == redirect {
+			continue
+		}
+		fmt.Println("Starting " + strings.ToUpper(scheme) + " Server at " + scheme + "://" + srv.Addr)
+		go func(srv *http.Server) {
+			var err error
+			if tlsConfig != nil {
+				err = srv.ListenAndServeTLS("", "")
+			} else {
+				err = srv.ListenAndServe()
+			}
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fmt.Println("Server error:", err)
+				os.Exit(1)
+			}
+		}(srv)
+	}
+
+	<-done
+	logging.Default().Info("server stopped")
 }
 
 func InitControllers(r *gin.Engine) {
+	// route on the escaped path, so an escaped separator stays part of its
+	// parameter and is rejected by ValidateParams
+	r.UseRawPath = true
 	r.NoRoute(NoRoute)
+	r.Use(RequestLogger(!config.Current().Log.DisableAccessLog))
+	r.Use(Metrics)
+	r.Use(ValidateParams)
 	r.GET("/api/:component/:channel/:os/:arch/json", GetUpdateJson)
 	r.GET("/api/:component/:channel/:os/:arch/:version/getbinary", GetBinary)
 	r.POST("/api/:component/:channel/:os/:arch/:version/uploadbinary", UploadBinary)
+	r.PUT("/api/:component/:channel/:os/:arch/:version/rollout", SetRollout)
+	r.PUT("/api/:component/:channel/:os/:arch/:version/mandatory", SetMandatory)
+	r.POST("/api/:component/:channel/:os/:arch/:version/share", ShareBinary)
+	r.PUT("/api/:component/:channel/minversion", SetMinimumVersion)
+	r.DELETE("/api/:component/:channel/minversion", ClearMinimumVersion)
 
 	r.GET("/", Index)
 	r.GET("/files/*content", Files)
 	r.PUT("/api/keys/add", AddPublicKey)
+	r.GET("/api/admin/usage", GetUsage)
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	r.GET("/healthz", Healthz)
+	r.GET("/readyz", Readyz)
 }
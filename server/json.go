@@ -2,13 +2,49 @@ package server
 
 import (
 	"encoding/json"
-	"os"
+	"path"
+	"time"
+
+	"wpkg.dev/wpkgup/storage"
 )
 
 type VersionJson struct {
 	Version  string `json:"version"`
 	Checksum string `json:"checksum"`
+	Size     int64  `json:"size,omitempty"`
 	Path     string `json:"path"`
+	// Blob is the checksum of the binary in the blob store, binaries of
+	// releases without it are stored at Path
+	Blob string `json:"blob,omitempty"`
+	// Signature is the checksum of signature.der in the blob store, the
+	// signature of releases without it is stored next to version.json
+	Signature string `json:"signature,omitempty"`
+	// Published is the time the version was uploaded, versions uploaded
+	// before publish times were recorded have none
+	Published *time.Time `json:"published,omitempty"`
+	// Rollout is the percentage of clients (0-100) that are offered this version
+	Rollout int `json:"rollout"`
+	// Mandatory releases must be installed before the client can be used
+	Mandatory bool `json:"mandatory"`
+	// Previous is served to clients outside of the rollout bucket
+	Previous *VersionJson `json:"previous,omitempty"`
+}
+
+// BinaryPath returns the location of the binary in the storage backend
+func (v VersionJson) BinaryPath() string {
+	if v.Blob != "" {
+		return BlobPath(v.Blob)
+	}
+	return storage.Join(v.Path)
+}
+
+// SignaturePath returns the location of signature.der of the release in the
+// storage backend
+func (v VersionJson) SignaturePath() string {
+	if v.Signature != "" {
+		return BlobPath(v.Signature)
+	}
+	return storage.Join(path.Dir(v.Path), "signature.der")
 }
 
 func GenerateVersionJson(path string, jsonMap VersionJson) error {
@@ -16,13 +52,42 @@ func GenerateVersionJson(path string, jsonMap VersionJson) error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, buf, 0664)
+	return storage.WriteFile(storage.Default, path, buf)
 }
 
 func ReadVersionJson(path string) (VersionJson, error) {
-	var jsonMap VersionJson
+	// version.json files written before staged rollouts are fully rolled out
+	jsonMap := VersionJson{Rollout: 100}
+
+	buf, err := storage.ReadFile(storage.Default, path)
+	if err != nil {
+		return jsonMap, err
+	}
+
+	err = json.Unmarshal(buf, &jsonMap)
+	if err != nil {
+		return jsonMap, err
+	}
+	return jsonMap, nil
+}
+
+type ChannelJson struct {
+	// MinimumVersion is the oldest version clients are allowed to keep using
+	MinimumVersion string `json:"minimum_version,omitempty"`
+}
+
+func GenerateChannelJson(path string, jsonMap ChannelJson) error {
+	buf, err := json.Marshal(jsonMap)
+	if err != nil {
+		return err
+	}
+	return storage.WriteFile(storage.Default, path, buf)
+}
+
+func ReadChannelJson(path string) (ChannelJson, error) {
+	var jsonMap ChannelJson
 
-	buf, err := os.ReadFile(path)
+	buf, err := storage.ReadFile(storage.Default, path)
 	if err != nil {
 		return jsonMap, err
 	}
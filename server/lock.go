@@ -0,0 +1,44 @@
+package server
+
+import (
+	"strings"
+	"sync"
+)
+
+var (
+	locksMutex sync.Mutex
+	locks      = map[string]*targetLock{}
+)
+
+type targetLock struct {
+	sync.Mutex
+	users int
+}
+
+// lockTarget serializes changes to the metadata of a target (for example
+// component, channel, os and arch), the returned function releases the lock
+func lockTarget(target ...string) func() {
+	key := strings.Join(target, "/")
+
+	locksMutex.Lock()
+	lock, ok := locks[key]
+	if !ok {
+		lock = &targetLock{}
+		locks[key] = lock
+	}
+	lock.users++
+	locksMutex.Unlock()
+
+	lock.Lock()
+
+	return func() {
+		lock.Unlock()
+
+		locksMutex.Lock()
+		lock.users--
+		if lock.users == 0 {
+			delete(locks, key)
+		}
+		locksMutex.Unlock()
+	}
+}
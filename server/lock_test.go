@@ -0,0 +1,178 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"wpkg.dev/wpkgup/crypto"
+	"wpkg.dev/wpkgup/storage"
+)
+
+// TestConcurrentUploads uploads many versions of one target at once while
+// readers check that the version.json of the target always points to a
+// complete release
+func TestConcurrentUploads(t *testing.T) {
+	r, memory, privateKey := newTestServer(t)
+
+	const uploads = 32
+	requests := make([]*http.Request, uploads)
+	for i := range requests {
+		content := []byte("binary " + strconv.Itoa(i))
+		requests[i] = uploadRequest(t, privateKey, fmt.Sprintf("/api/app/stable/linux/amd64/1.0.%d/uploadbinary", i), content)
+	}
+
+	latestPath := storage.Join(archDir("app", "stable", "linux", "amd64"), "version.json")
+	checkLatest := func() error {
+		// nothing published yet, it is never removed afterwards
+		if !storage.Exists(memory, latestPath) {
+			return nil
+		}
+		release, err := ReadVersionJson(latestPath)
+		if err != nil {
+			return fmt.Errorf("version.json doesn't parse: %w", err)
+		}
+		binary, err := storage.ReadFile(memory, release.BinaryPath())
+		if err != nil {
+			return fmt.Errorf("binary of %s: %w", release.Version, err)
+		}
+		checksum := sha256.Sum256(binary)
+		if hex.EncodeToString(checksum[:]) != release.Checksum {
+			return fmt.Errorf("checksum of %s doesn't match its blob", release.Version)
+		}
+		if !storage.Exists(memory, release.SignaturePath()) {
+			return fmt.Errorf("signature of %s is missing", release.Version)
+		}
+		return nil
+	}
+
+	var done atomic.Bool
+	readErrs := make(chan error, 4)
+	var readers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for !done.Load() {
+				if err := checkLatest(); err != nil {
+					readErrs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	var uploaders sync.WaitGroup
+	statuses := make([]int, uploads)
+	for i, req := range requests {
+		uploaders.Add(1)
+		go func(i int, req *http.Request) {
+			defer uploaders.Done()
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			statuses[i] = w.Code
+		}(i, req)
+	}
+	uploaders.Wait()
+	done.Store(true)
+	readers.Wait()
+
+	for i, status := range statuses {
+		if status != http.StatusCreated {
+			t.Errorf("upload of 1.0.%d answered %d", i, status)
+		}
+	}
+	close(readErrs)
+	for err := range readErrs {
+		t.Fatal(err)
+	}
+	if err := checkLatest(); err != nil {
+		t.Fatal(err)
+	}
+
+	releases, err := ListReleases("app", "stable", "linux", "amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(releases) != uploads {
+		t.Errorf("%d releases published, want %d", len(releases), uploads)
+	}
+}
+
+// TestConcurrentUploadsOfOneVersion uploads different binaries as the same
+// version at once, only one of them may be published
+func TestConcurrentUploadsOfOneVersion(t *testing.T) {
+	r, memory, privateKey := newTestServer(t)
+
+	const uploads = 16
+	requests := make([]*http.Request, uploads)
+	for i := range requests {
+		content := []byte("binary " + strconv.Itoa(i))
+		requests[i] = uploadRequest(t, privateKey, "/api/app/stable/linux/amd64/2.0.0/uploadbinary", content)
+	}
+
+	var wg sync.WaitGroup
+	statuses := make([]int, uploads)
+	for i, req := range requests {
+		wg.Add(1)
+		go func(i int, req *http.Request) {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			statuses[i] = w.Code
+		}(i, req)
+	}
+	wg.Wait()
+
+	created := 0
+	for i, status := range statuses {
+		switch status {
+		case http.StatusCreated:
+			created++
+		case http.StatusConflict:
+		default:
+			t.Errorf("upload %d answered %d", i, status)
+		}
+	}
+	if created != 1 {
+		t.Fatalf("%d uploads were published, want 1", created)
+	}
+
+	dir := storage.Join(archDir("app", "stable", "linux", "amd64"), "2.0.0")
+	release, err := ReadVersionJson(storage.Join(dir, "version.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest, err := ReadVersionJson(storage.Join(archDir("app", "stable", "linux", "amd64"), "version.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.Checksum != release.Checksum {
+		t.Errorf("latest version.json has checksum %s, the release %s", latest.Checksum, release.Checksum)
+	}
+
+	binary, err := storage.ReadFile(memory, release.BinaryPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := storage.ReadFile(memory, release.SignaturePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "app.bin")
+	if err := os.WriteFile(file, binary, 0600); err != nil {
+		t.Fatal(err)
+	}
+	ok, err := crypto.Verify(crypto.GeneratePublicFromPrivate(privateKey), file, signature)
+	if err != nil || !ok {
+		t.Errorf("signature of the release doesn't verify its binary: %v", err)
+	}
+}
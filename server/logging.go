@@ -0,0 +1,71 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"wpkg.dev/wpkgup/logging"
+)
+
+const (
+	requestIdHeader = "X-Request-ID"
+	loggerKey       = "logger"
+)
+
+// requestIdPattern limits request IDs taken from clients, so they can't
+// inject anything into the log
+var requestIdPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+func newRequestId() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// RequestLogger gives every request an ID, echoed in the X-Request-ID header,
+// and a logger with the ID, client IP and route parameters. With accessLog
+// every request is logged when it finished.
+func RequestLogger(accessLog bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		id := c.GetHeader(requestIdHeader)
+		if !requestIdPattern.MatchString(id) {
+			id = newRequestId()
+		}
+		c.Header(requestIdHeader, id)
+
+		fields := []interface{}{"request_id", id, "client_ip", c.ClientIP()}
+		for _, param := range c.Params {
+			fields = append(fields, param.Key, param.Value)
+		}
+		c.Set(loggerKey, logging.Default().With(fields...))
+
+		c.Next()
+
+		if accessLog {
+			size := c.Writer.Size()
+			if size < 0 {
+				size = 0
+			}
+			reqLog(c).Info("request",
+				"method", c.Request.Method,
+				"path", c.Request.URL.Path,
+				"status", c.Writer.Status(),
+				"bytes", size,
+				"duration", time.Since(start))
+		}
+	}
+}
+
+// reqLog returns the logger of a request with the identity of the caller
+func reqLog(c *gin.Context) *logging.Logger {
+	l, ok := c.Value(loggerKey).(*logging.Logger)
+	if !ok {
+		l = logging.Default()
+	}
+	return l.With("identity", caller(c))
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"wpkg.dev/wpkgup/config"
+	"wpkg.dev/wpkgup/keystore"
+)
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wpkgup_http_requests_total",
+		Help: "HTTP requests by route, method and status.",
+	}, []string{"route", "method", "status"})
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "wpkgup_http_request_duration_seconds",
+		Help:    "Duration of HTTP requests by route and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+	responseBytesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wpkgup_http_response_bytes_total",
+		Help: "Bytes served by route.",
+	}, []string{"route"})
+	updateChecksTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wpkgup_update_checks_total",
+		Help: "Requests of the latest version.json by component and channel, private channels are counted as \"private\".",
+	}, []string{"component", "channel"})
+	downloadsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wpkgup_downloads_total",
+		Help: "Binary downloads by component, channel and version, private channels are counted as \"private\".",
+	}, []string{"component", "channel", "version"})
+	uploadDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "wpkgup_upload_duration_seconds",
+		Help:    "Duration of published uploads.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 12),
+	})
+	uploadSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "wpkgup_upload_size_bytes",
+		Help:    "Size of published binaries.",
+		Buckets: prometheus.ExponentialBuckets(1<<20, 2, 12),
+	})
+	signatureFailuresTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "wpkgup_signature_verification_failures_total",
+		Help: "Uploads rejected because no key verified their signature.",
+	})
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "wpkgup_keystore_keys",
+		Help: "Public keys in the keystore.",
+	}, func() float64 {
+		return float64(len(keystore.Keys()))
+	})
+)
+
+// privateLabel replaces the component, channel and version labels of private
+// channels, /metrics is served without credentials
+const privateLabel = "private"
+
+// releaseLabels returns the labels of component and channel followed by
+// more, all of them are "private" for private channels
+func releaseLabels(component, channel string, more ...string) []string {
+	labels := append([]string{component, channel}, more...)
+	if config.Current().IsPrivate(component, channel) {
+		for i := range labels {
+			labels[i] = privateLabel
+		}
+	}
+	return labels
+}
+
+// Metrics counts requests, their duration and the bytes served by route.
+// Requests without a route are counted as "unmatched", so scans can't create
+// new series.
+func Metrics(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	requestsTotal.WithLabelValues(route, c.Request.Method, strconv.Itoa(c.Writer.Status())).Inc()
+	requestDuration.WithLabelValues(route, c.Request.Method).Observe(time.Since(start).Seconds())
+	if size := c.Writer.Size(); size > 0 {
+		responseBytesTotal.WithLabelValues(route).Add(float64(size))
+	}
+}
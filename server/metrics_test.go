@@ -0,0 +1,57 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"wpkg.dev/wpkgup/config"
+	"wpkg.dev/wpkgup/tokens"
+)
+
+func TestMetricsHidePrivateChannels(t *testing.T) {
+	r, _, privateKey := newTestServer(t)
+	config.Set(config.Config{Channels: map[string]config.ChannelConfig{"secret-app": {Private: true}}})
+	if err := tokens.Init(); err != nil {
+		t.Fatal(err)
+	}
+	token, err := tokens.Create("reader", tokens.RoleReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, component := range []string{"public-app", "secret-app"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, uploadRequest(t, privateKey, "/api/"+component+"/stable/linux/amd64/1.0.0/uploadbinary", []byte("binary")))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("upload of %s answered %d", component, w.Code)
+		}
+		for _, path := range []string{"/stable/linux/amd64/json", "/stable/linux/amd64/1.0.0/getbinary"} {
+			req := httptest.NewRequest("GET", "/api/"+component+path, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w = httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("GET %s%s answered %d", component, path, w.Code)
+			}
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	metrics := w.Body.String()
+	for _, want := range []string{
+		`wpkgup_update_checks_total{channel="stable",component="public-app"}`,
+		`wpkgup_downloads_total{channel="stable",component="public-app",version="1.0.0"}`,
+		`wpkgup_update_checks_total{channel="private",component="private"}`,
+		`wpkgup_downloads_total{channel="private",component="private",version="private"}`,
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("metrics don't contain %s", want)
+		}
+	}
+	if strings.Contains(metrics, "secret-app") {
+		t.Error("metrics contain the name of a private component")
+	}
+}
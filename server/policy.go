@@ -0,0 +1,63 @@
+package server
+
+import (
+	"github.com/Masterminds/semver/v3"
+	"wpkg.dev/wpkgup/storage"
+)
+
+// UpdateJson is returned to clients checking for updates
+type UpdateJson struct {
+	VersionJson
+	MinimumVersion string `json:"minimum_version,omitempty"`
+}
+
+func channelJsonPath(component, channel string) string {
+	return storage.Join(component, channel, "channel.json")
+}
+
+// ReadChannelPolicy returns the policy of a channel, channels without
+// channel.json have no policy
+func ReadChannelPolicy(component, channel string) (ChannelJson, error) {
+	path := channelJsonPath(component, channel)
+	if !storage.Exists(storage.Default, path) {
+		return ChannelJson{}, nil
+	}
+	return ReadChannelJson(path)
+}
+
+// versionLess reports whether version a is older than b, versions which are
+// not valid semver are never considered older
+func versionLess(a, b string) bool {
+	va, err := semver.NewVersion(a)
+	if err != nil {
+		return false
+	}
+	vb, err := semver.NewVersion(b)
+	if err != nil {
+		return false
+	}
+	return va.LessThan(vb)
+}
+
+// IsMandatory reports whether a client running current must update, either
+// because it is below the channel minimum or a newer release is mandatory
+func IsMandatory(release VersionJson, policy ChannelJson, current string, releases []VersionJson) bool {
+	if _, err := semver.NewVersion(current); err != nil {
+		return release.Mandatory
+	}
+	if !versionLess(current, release.Version) {
+		return false
+	}
+	if release.Mandatory {
+		return true
+	}
+	if policy.MinimumVersion != "" && versionLess(current, policy.MinimumVersion) {
+		return true
+	}
+	for _, r := range releases {
+		if r.Mandatory && versionLess(current, r.Version) && !versionLess(release.Version, r.Version) {
+			return true
+		}
+	}
+	return false
+}
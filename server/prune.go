@@ -0,0 +1,219 @@
+package server
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"wpkg.dev/wpkgup/config"
+	"wpkg.dev/wpkgup/logging"
+	"wpkg.dev/wpkgup/storage"
+)
+
+const defaultPruneInterval = time.Hour
+
+type PrunedVersion struct {
+	Component string
+	Channel   string
+	Os        string
+	Arch      string
+	Version   string
+	Published time.Time
+	Reason    string
+}
+
+// Prune removes versions which are not kept by the retention policy of their
+// channel. The latest version, the version served to clients outside of its
+// rollout and pinned versions are never removed.
+func Prune(dryRun bool) ([]PrunedVersion, error) {
+	var pruned []PrunedVersion
+
+	components, err := storage.Default.List("")
+	if err != nil {
+		return nil, err
+	}
+	for _, component := range components {
+		if !component.IsDir || component.Name == BlobDir {
+			continue
+		}
+		channels, err := storage.Default.List(component.Name)
+		if err != nil {
+			return pruned, err
+		}
+		for _, channel := range channels {
+			policy := config.Current().Channel(component.Name, channel.Name)
+			if !channel.IsDir || !policy.HasRetention() {
+				continue
+			}
+			oses, err := storage.Default.List(storage.Join(component.Name, channel.Name))
+			if err != nil {
+				return pruned, err
+			}
+			for _, Os := range oses {
+				if !Os.IsDir {
+					continue
+				}
+				arches, err := storage.Default.List(storage.Join(component.Name, channel.Name, Os.Name))
+				if err != nil {
+					return pruned, err
+				}
+				for _, arch := range arches {
+					if !arch.IsDir {
+						continue
+					}
+					p, err := pruneTarget(component.Name, channel.Name, Os.Name, arch.Name, policy, dryRun)
+					pruned = append(pruned, p...)
+					if err != nil {
+						return pruned, err
+					}
+				}
+			}
+		}
+	}
+	return pruned, nil
+}
+
+func pruneTarget(component, channel, Os, arch string, policy config.ChannelConfig, dryRun bool) ([]PrunedVersion, error) {
+	dir := archDir(component, channel, Os, arch)
+
+	unlock := lockTarget(component, channel, Os, arch)
+	defer unlock()
+
+	latest, err := ReadVersionJson(storage.Join(dir, "version.json"))
+	if err != nil {
+		// nothing was published to this target
+		return nil, nil
+	}
+	keep := map[string]bool{latest.Version: true}
+	if latest.Previous != nil {
+		keep[latest.Previous.Version] = true
+	}
+	for _, version := range policy.Pinned {
+		keep[version] = true
+	}
+
+	entries, err := storage.Default.List(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []PrunedVersion
+	for _, entry := range entries {
+		if !entry.IsDir {
+			continue
+		}
+		versionPath := storage.Join(dir, entry.Name, "version.json")
+		release, err := ReadVersionJson(versionPath)
+		if err != nil {
+			continue
+		}
+		var published time.Time
+		if release.Published != nil {
+			published = *release.Published
+		} else {
+			// versions uploaded before publish times were recorded
+			info, err := storage.Default.Stat(versionPath)
+			if err != nil {
+				return nil, err
+			}
+			published = info.ModTime
+		}
+		versions = append(versions, PrunedVersion{
+			Component: component,
+			Channel:   channel,
+			Os:        Os,
+			Arch:      arch,
+			Version:   entry.Name,
+			Published: published,
+		})
+	}
+
+	// newest first
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Published.After(versions[j].Published)
+	})
+
+	cutoff := time.Now().AddDate(0, 0, -policy.KeepDays)
+
+	var pruned []PrunedVersion
+	for i, version := range versions {
+		if keep[version.Version] {
+			continue
+		}
+		if policy.KeepLast > 0 && i < policy.KeepLast {
+			continue
+		}
+		if policy.KeepDays > 0 && version.Published.After(cutoff) {
+			continue
+		}
+
+		if policy.KeepLast > 0 {
+			version.Reason = "not in last " + strconv.Itoa(policy.KeepLast) + " versions"
+		}
+		if policy.KeepDays > 0 {
+			if version.Reason != "" {
+				version.Reason += ", "
+			}
+			version.Reason += "older than " + strconv.Itoa(policy.KeepDays) + " days"
+		}
+
+		if !dryRun {
+			since := time.Now()
+			size, _ := Usage(storage.Join(dir, version.Version))
+			err := storage.Default.Delete(storage.Join(dir, version.Version))
+			if err != nil {
+				return pruned, err
+			}
+			addUsage(component, channel, -size, since)
+		}
+		pruned = append(pruned, version)
+	}
+	return pruned, nil
+}
+
+// hasRetention reports whether any channel has a retention policy
+func hasRetention() bool {
+	for _, channel := range config.Current().Channels {
+		if channel.HasRetention() {
+			return true
+		}
+	}
+	return false
+}
+
+// runPruner periodically prunes old versions and removes binaries which are
+// no longer referenced afterwards, the policies are read from the current
+// config every time
+func runPruner() {
+	for {
+		if hasRetention() {
+			prune()
+		}
+
+		interval := time.Duration(config.Current().PruneInterval)
+		if interval <= 0 {
+			interval = defaultPruneInterval
+		}
+		time.Sleep(interval)
+	}
+}
+
+func prune() {
+	pruned, err := Prune(false)
+	for _, version := range pruned {
+		logging.Default().Info("pruned version", "component", version.Component, "channel", version.Channel, "os", version.Os, "arch", version.Arch, "version", version.Version, "reason", version.Reason)
+	}
+	if err != nil {
+		logging.Default().Error("prune failed", "error", err)
+	}
+
+	if len(pruned) > 0 {
+		removed, err := CollectGarbage(DefaultGCGrace, false)
+		if err != nil {
+			logging.Default().Error("garbage collection failed", "error", err)
+		}
+		if len(removed) > 0 {
+			logging.Default().Info("removed unreferenced binaries", "count", len(removed))
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"wpkg.dev/wpkgup/config"
+	"wpkg.dev/wpkgup/storage"
+)
+
+func TestPrune(t *testing.T) {
+	r, memory, privateKey := newTestServer(t)
+	config.Set(config.Config{Channels: map[string]config.ChannelConfig{
+		"app/stable": {KeepLast: 1, Pinned: []string{"1.0.0"}, Quota: 1 << 30},
+	}})
+
+	// 1.1.0 shares its binary with the pinned 1.0.0, 1.2.0 is the previous
+	// release of 1.3.0
+	binaries := []struct{ version, content string }{
+		{"0.9.0", "binary 0.9.0"},
+		{"1.0.0", "shared binary"},
+		{"1.1.0", "shared binary"},
+		{"1.2.0", "binary 1.2.0"},
+		{"1.3.0", "binary 1.3.0"},
+	}
+	for _, binary := range binaries {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, uploadRequest(t, privateKey, "/api/app/stable/linux/amd64/"+binary.version+"/uploadbinary", []byte(binary.content)))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("upload of %s answered %d: %s", binary.version, w.Code, w.Body)
+		}
+	}
+	dir := archDir("app", "stable", "linux", "amd64")
+	releases := map[string]VersionJson{}
+	var prunedSize int64
+	for _, version := range []string{"0.9.0", "1.0.0", "1.1.0", "1.2.0", "1.3.0"} {
+		release, err := ReadVersionJson(storage.Join(dir, version, "version.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		releases[version] = release
+		if version == "0.9.0" || version == "1.1.0" {
+			size, err := Usage(storage.Join(dir, version))
+			if err != nil {
+				t.Fatal(err)
+			}
+			prunedSize += size
+		}
+	}
+
+	usageBefore, err := Usage("app/stable")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dryRun, err := Prune(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := prunedVersions(dryRun); got != "0.9.0 1.1.0" {
+		t.Fatalf("dry run prunes %q, want 0.9.0 1.1.0", got)
+	}
+	for version := range releases {
+		if !storage.Exists(memory, storage.Join(dir, version, "version.json")) {
+			t.Fatalf("dry run removed %s", version)
+		}
+	}
+
+	pruned, err := Prune(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := prunedVersions(pruned); got != "0.9.0 1.1.0" {
+		t.Fatalf("pruned %q, want 0.9.0 1.1.0", got)
+	}
+	for version := range releases {
+		exists := storage.Exists(memory, storage.Join(dir, version, "version.json"))
+		if want := version != "0.9.0" && version != "1.1.0"; exists != want {
+			t.Errorf("%s exists = %v after pruning, want %v", version, exists, want)
+		}
+	}
+
+	removed, err := CollectGarbage(0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var removedBlobs []string
+	for _, blob := range removed {
+		removedBlobs = append(removedBlobs, blob.Checksum)
+	}
+	sort.Strings(removedBlobs)
+	wantRemoved := []string{releases["0.9.0"].Blob, releases["0.9.0"].Signature, releases["1.1.0"].Signature}
+	sort.Strings(wantRemoved)
+	if strings.Join(removedBlobs, " ") != strings.Join(wantRemoved, " ") {
+		t.Errorf("garbage collection removed %q, want the binary of 0.9.0 and the signatures of 0.9.0 and 1.1.0", removedBlobs)
+	}
+	for _, version := range []string{"1.0.0", "1.2.0", "1.3.0"} {
+		if !storage.Exists(memory, releases[version].BinaryPath()) {
+			t.Errorf("binary of %s was removed", version)
+		}
+		if !storage.Exists(memory, releases[version].SignaturePath()) {
+			t.Errorf("signature of %s was removed", version)
+		}
+	}
+
+	// the cached usage of the quota went down by the pruned versions
+	usageAfter, err := Usage("app/stable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usageAfter != usageBefore-prunedSize {
+		t.Errorf("usage is %d after pruning, want %d", usageAfter, usageBefore-prunedSize)
+	}
+	usageMutex.Lock()
+	cached := usages["app/stable"].bytes
+	usageMutex.Unlock()
+	if cached != usageAfter {
+		t.Errorf("cached usage is %d after pruning, want %d", cached, usageAfter)
+	}
+
+	latest, err := ReadVersionJson(storage.Join(dir, "version.json"))
+	if err != nil || latest.Version != "1.3.0" || latest.Previous == nil || latest.Previous.Version != "1.2.0" {
+		t.Errorf("version.json of the target changed: %+v, %v", latest, err)
+	}
+}
+
+func TestPruneKeepsRecentVersions(t *testing.T) {
+	r, _, privateKey := newTestServer(t)
+	config.Set(config.Config{Channels: map[string]config.ChannelConfig{
+		"app": {KeepDays: 1},
+	}})
+
+	for _, version := range []string{"1.0.0", "1.1.0", "1.2.0"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, uploadRequest(t, privateKey, "/api/app/stable/linux/amd64/"+version+"/uploadbinary", []byte("binary "+version)))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("upload of %s answered %d", version, w.Code)
+		}
+	}
+	pruned, err := Prune(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) > 0 {
+		t.Errorf("pruned %q published today", prunedVersions(pruned))
+	}
+}
+
+func prunedVersions(pruned []PrunedVersion) string {
+	var versions []string
+	for _, version := range pruned {
+		versions = append(versions, version.Version)
+	}
+	sort.Strings(versions)
+	return strings.Join(versions, " ")
+}
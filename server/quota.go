@@ -0,0 +1,275 @@
+package server
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"wpkg.dev/wpkgup/config"
+	"wpkg.dev/wpkgup/storage"
+	"wpkg.dev/wpkgup/tokens"
+)
+
+// Usage returns the bytes stored below dir. Binaries and signatures kept in
+// the blob store are counted for every version referencing them.
+func Usage(dir string) (int64, error) {
+	entries, err := storage.Default.List(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var usage int64
+	for _, entry := range entries {
+		p := storage.Join(dir, entry.Name)
+		if entry.IsDir {
+			if p == BlobDir {
+				continue
+			}
+			size, err := Usage(p)
+			if err != nil {
+				return 0, err
+			}
+			usage += size
+			continue
+		}
+
+		usage += entry.Size
+		if entry.Name == "version.json" {
+			if release, ok := blobRelease(dir); ok && path.Base(dir) == release.Version {
+				usage += release.Size
+				if release.Signature != "" {
+					if info, err := storage.Default.Stat(release.SignaturePath()); err == nil {
+						usage += info.Size
+					}
+				}
+			}
+		}
+	}
+	return usage, nil
+}
+
+type quota struct {
+	name  string
+	dir   string
+	limit int64
+}
+
+// quotas returns the quotas applying to uploads to a channel
+func quotas(component, channel string) []quota {
+	var list []quota
+	if conf, ok := config.Current().Channels[component]; ok && conf.Quota > 0 {
+		list = append(list, quota{name: "component " + component, dir: storage.Join(component), limit: int64(conf.Quota)})
+	}
+	if conf, ok := config.Current().Channels[component+"/"+channel]; ok && conf.Quota > 0 {
+		list = append(list, quota{name: "channel " + component + "/" + channel, dir: storage.Join(component, channel), limit: int64(conf.Quota)})
+	}
+	return list
+}
+
+var errQuotaExceeded = errors.New("QUOTA_EXCEEDED")
+
+// usageRefresh is how long the cached usage of a quota is trusted. It bounds
+// the drift from changes which aren't counted, like uploads of other servers
+// sharing the storage and rewrites of version.json by rollout changes.
+const usageRefresh = time.Hour
+
+type dirUsage struct {
+	bytes    int64
+	reserved int64
+	computed time.Time
+}
+
+// usages caches the usage of quota directories, so uploads don't walk the
+// whole component. Uploads and pruning add their changes to it.
+var (
+	usageMutex sync.Mutex
+	usages     = map[string]*dirUsage{}
+)
+
+// loadUsage returns the usage of dir, computing it if it isn't cached or is
+// stale, usageMutex must be held
+func loadUsage(dir string) (*dirUsage, error) {
+	u, ok := usages[dir]
+	if ok && time.Since(u.computed) < usageRefresh {
+		return u, nil
+	}
+
+	bytes, err := Usage(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if !ok {
+		u = &dirUsage{}
+		usages[dir] = u
+	}
+	u.bytes = bytes
+	u.computed = time.Now()
+	return u, nil
+}
+
+// addUsage adds delta bytes written to or removed from a channel since the
+// given time to the cached usage. Usage computed in the meantime may already
+// contain some of them, so it is computed again instead.
+func addUsage(component, channel string, delta int64, since time.Time) {
+	usageMutex.Lock()
+	defer usageMutex.Unlock()
+
+	for _, dir := range []string{storage.Join(component), storage.Join(component, channel)} {
+		u, ok := usages[dir]
+		if !ok {
+			continue
+		}
+		if u.computed.After(since) {
+			u.computed = time.Time{}
+			continue
+		}
+		u.bytes += delta
+	}
+}
+
+// reservation holds bytes of the quotas of a channel for a running upload
+type reservation struct {
+	// remaining is the number of bytes which could still be uploaded before
+	// the reservation, a negative number means no limit
+	remaining int64
+	// name is the quota limiting the upload
+	name     string
+	dirs     []string
+	reserved int64
+}
+
+// reserveQuota reserves size bytes of every quota applying to uploads to a
+// channel, or all remaining bytes if size is negative, so concurrent uploads
+// can't exceed the quota together. Nothing is reserved if size doesn't fit.
+func reserveQuota(component, channel string, size int64) (*reservation, error) {
+	usageMutex.Lock()
+	defer usageMutex.Unlock()
+
+	r := &reservation{remaining: -1}
+	var reserved []*dirUsage
+	for _, q := range quotas(component, channel) {
+		u, err := loadUsage(q.dir)
+		if err != nil {
+			return nil, err
+		}
+		left := q.limit - u.bytes - u.reserved
+		if left < 0 {
+			left = 0
+		}
+		if r.remaining < 0 || left < r.remaining {
+			r.remaining = left
+			r.name = q.name
+		}
+		r.dirs = append(r.dirs, q.dir)
+		reserved = append(reserved, u)
+	}
+
+	if r.remaining <= 0 || size > r.remaining {
+		r.dirs = nil
+		return r, nil
+	}
+	r.reserved = r.remaining
+	if size >= 0 {
+		r.reserved = size
+	}
+	for _, u := range reserved {
+		u.reserved += r.reserved
+	}
+	return r, nil
+}
+
+// release returns the reserved bytes, once the upload is stored or failed
+func (r *reservation) release() {
+	usageMutex.Lock()
+	defer usageMutex.Unlock()
+
+	for _, dir := range r.dirs {
+		if u, ok := usages[dir]; ok {
+			u.reserved -= r.reserved
+		}
+	}
+	r.dirs = nil
+}
+
+// versionUsage returns the usage of a version and the version.json of its
+// target, which are the files an upload of the version changes
+func versionUsage(component, channel, Os, arch, version string) int64 {
+	dir := archDir(component, channel, Os, arch)
+	usage, _ := Usage(storage.Join(dir, version))
+	if info, err := storage.Default.Stat(storage.Join(dir, "version.json")); err == nil {
+		usage += info.Size
+	}
+	return usage
+}
+
+func quotaExceeded(c *gin.Context, status int, name string) {
+	c.JSON(status, gin.H{"error": errQuotaExceeded.Error(), "message": "Storage quota of " + name + " exceeded"})
+}
+
+type ChannelUsage struct {
+	Channel string `json:"channel"`
+	Usage   int64  `json:"usage"`
+	Quota   int64  `json:"quota,omitempty"`
+}
+
+type ComponentUsage struct {
+	Component string         `json:"component"`
+	Usage     int64          `json:"usage"`
+	Quota     int64          `json:"quota,omitempty"`
+	Channels  []ChannelUsage `json:"channels"`
+}
+
+func GetUsage(c *gin.Context) {
+	if !authorize(c, tokens.RoleAdmin) {
+		return
+	}
+
+	components, err := storage.Default.List("")
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := []ComponentUsage{}
+	for _, component := range components {
+		if !component.IsDir || component.Name == BlobDir {
+			continue
+		}
+
+		componentUsage := ComponentUsage{
+			Component: component.Name,
+			Quota:     int64(config.Current().Channels[component.Name].Quota),
+			Channels:  []ChannelUsage{},
+		}
+
+		channels, err := storage.Default.List(component.Name)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		for _, channel := range channels {
+			if !channel.IsDir {
+				componentUsage.Usage += channel.Size
+				continue
+			}
+			usage, err := Usage(storage.Join(component.Name, channel.Name))
+			if err != nil {
+				c.JSON(500, gin.H{"error": err.Error()})
+				return
+			}
+			componentUsage.Usage += usage
+			componentUsage.Channels = append(componentUsage.Channels, ChannelUsage{
+				Channel: channel.Name,
+				Usage:   usage,
+				Quota:   int64(config.Current().Channels[component.Name+"/"+channel.Name].Quota),
+			})
+		}
+		result = append(result, componentUsage)
+	}
+
+	c.JSON(http.StatusOK, result)
+}
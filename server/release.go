@@ -0,0 +1,145 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Masterminds/semver/v3"
+	"wpkg.dev/wpkgup/storage"
+)
+
+var (
+	errInvalidComponent  = errors.New("INVALID_COMPONENT")
+	errNoRelease         = errors.New("NO_RELEASE_AVAILABLE")
+	errInvalidConstraint = errors.New("INVALID_CONSTRAINT")
+)
+
+// releaseErrorStatus maps errors returned by ResolveLatest to HTTP status codes
+func releaseErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errInvalidComponent), errors.Is(err, errNoRelease):
+		return http.StatusNotFound
+	case errors.Is(err, errInvalidConstraint):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// ResolveLatest returns the release offered to a client asking for the latest
+// version of the target, limited to versions satisfying constraint if given
+func ResolveLatest(component, channel, Os, arch, constraint, id string) (VersionJson, error) {
+	if constraint == "" {
+		latest, err := ReadVersionJson(storage.Join(archDir(component, channel, Os, arch), "version.json"))
+		if err != nil {
+			return latest, errInvalidComponent
+		}
+		release, ok := ResolveRelease(latest, id)
+		if !ok {
+			return release, errNoRelease
+		}
+		return release, nil
+	}
+
+	constraints, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return VersionJson{}, fmt.Errorf("%w: %s", errInvalidConstraint, err)
+	}
+
+	releases, err := ListReleases(component, channel, Os, arch)
+	if err != nil {
+		return VersionJson{}, errInvalidComponent
+	}
+
+	release, ok := NewestRelease(releases, constraints, id)
+	if !ok {
+		return release, errNoRelease
+	}
+	return release, nil
+}
+
+func archDir(component, channel, Os, arch string) string {
+	return storage.Join(component, channel, Os, arch)
+}
+
+// ListReleases returns all versions published for the given target
+func ListReleases(component, channel, Os, arch string) ([]VersionJson, error) {
+	dir := archDir(component, channel, Os, arch)
+
+	entries, err := storage.Default.List(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var releases []VersionJson
+	for _, entry := range entries {
+		if !entry.IsDir {
+			continue
+		}
+		release, err := ReadVersionJson(storage.Join(dir, entry.Name, "version.json"))
+		if err != nil {
+			continue
+		}
+		releases = append(releases, release)
+	}
+	return releases, nil
+}
+
+// UpdateRelease applies change to the version.json of the given version and to
+// every copy of it referenced by the latest version.json of the target
+func UpdateRelease(component, channel, Os, arch, version string, change func(*VersionJson)) error {
+	dir := archDir(component, channel, Os, arch)
+
+	versionPath := storage.Join(dir, version, "version.json")
+	versionJson, err := ReadVersionJson(versionPath)
+	if err != nil {
+		return err
+	}
+	change(&versionJson)
+	err = GenerateVersionJson(versionPath, versionJson)
+	if err != nil {
+		return err
+	}
+
+	latestPath := storage.Join(dir, "version.json")
+	latest, err := ReadVersionJson(latestPath)
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	if latest.Version == version {
+		change(&latest)
+		changed = true
+	}
+	if latest.Previous != nil && latest.Previous.Version == version {
+		change(latest.Previous)
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return GenerateVersionJson(latestPath, latest)
+}
+
+// NewestRelease returns the newest release satisfying constraint which the
+// client is allowed to get, releases with non-semver versions are skipped
+func NewestRelease(releases []VersionJson, constraint *semver.Constraints, id string) (VersionJson, bool) {
+	var newest VersionJson
+	var newestVersion *semver.Version
+
+	for _, release := range releases {
+		version, err := semver.NewVersion(release.Version)
+		if err != nil {
+			continue
+		}
+		if !constraint.Check(version) || !InRollout(release, id) {
+			continue
+		}
+		if newestVersion == nil || version.GreaterThan(newestVersion) {
+			newest = release
+			newestVersion = version
+		}
+	}
+	return newest, newestVersion != nil
+}
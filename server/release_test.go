@@ -0,0 +1,82 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"wpkg.dev/wpkgup/tokens"
+)
+
+// TestRolloutOfSupersededRelease completes the rollout of a release which was
+// superseded while it was ramped up, clients asking with a constraint still
+// get it
+func TestRolloutOfSupersededRelease(t *testing.T) {
+	r, _, privateKey := newTestServer(t)
+	if err := tokens.Init(); err != nil {
+		t.Fatal(err)
+	}
+	token, err := tokens.Create("publisher", tokens.RolePublisher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := "/api/app/stable/linux/amd64/"
+
+	setRollout := func(version string, rollout int) int {
+		req := httptest.NewRequest("PUT", target+version+"/rollout", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Rollout", strconv.Itoa(rollout))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	// offered counts the clients getting each version with constraint
+	offered := func(constraint string) map[string]int {
+		versions := map[string]int{}
+		for i := 0; i < 100; i++ {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", target+"json?constraint="+constraint+"&client_id=client-"+strconv.Itoa(i), nil))
+			var update UpdateJson
+			if err := json.Unmarshal(w.Body.Bytes(), &update); err != nil || w.Code != http.StatusOK {
+				t.Fatalf("update check answered %d: %s", w.Code, w.Body)
+			}
+			versions[update.Version]++
+		}
+		return versions
+	}
+
+	for _, version := range []string{"1.0.0", "1.1.0"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, uploadRequest(t, privateKey, target+version+"/uploadbinary", []byte("binary "+version)))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("upload of %s answered %d", version, w.Code)
+		}
+	}
+	if code := setRollout("1.1.0", 10); code != http.StatusOK {
+		t.Fatalf("set-rollout of latest answered %d", code)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, uploadRequest(t, privateKey, target+"1.2.0/uploadbinary", []byte("binary 1.2.0")))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("upload of 1.2.0 answered %d", w.Code)
+	}
+
+	if versions := offered("%3C1.2.0"); versions["1.0.0"] == 0 {
+		t.Fatalf("clients outside the 10%% rollout don't get 1.0.0: %v", versions)
+	}
+	if code := setRollout("1.1.0", 100); code != http.StatusOK {
+		t.Fatalf("set-rollout of superseded release answered %d", code)
+	}
+	if versions := offered("%3C1.2.0"); versions["1.1.0"] != 100 {
+		t.Errorf("completed rollout of 1.1.0 offered %v", versions)
+	}
+	if versions := offered(""); versions["1.2.0"] != 100 {
+		t.Errorf("latest offered %v", versions)
+	}
+
+	if code := setRollout("0.9.0", 100); code != http.StatusNotFound {
+		t.Errorf("set-rollout of missing version answered %d, want 404", code)
+	}
+}
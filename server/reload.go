@@ -0,0 +1,89 @@
+package server
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"wpkg.dev/wpkgup/config"
+	"wpkg.dev/wpkgup/keystore"
+	"wpkg.dev/wpkgup/logging"
+)
+
+// reloadPollInterval is how often the config and keystore files are checked
+// for changes
+const reloadPollInterval = 5 * time.Second
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// watchReload reloads the config and keystore on SIGHUP or when their files
+// change. Invalid files are logged and the loaded ones kept.
+func watchReload() {
+	configPath := filepath.Join(config.WorkDir, config.ConfigFile)
+	configTime := modTime(configPath)
+	keystoreTime := modTime(keystore.KeystorePath)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	ticker := time.NewTicker(reloadPollInterval)
+	defer ticker.Stop()
+
+	for {
+		force := false
+		select {
+		case <-hup:
+			force = true
+		case <-ticker.C:
+		}
+
+		if t := modTime(configPath); force || !t.Equal(configTime) {
+			configTime = t
+			reloadConfig()
+		}
+		if t := modTime(keystore.KeystorePath); force || !t.Equal(keystoreTime) {
+			keystoreTime = t
+			reloadKeystore()
+		}
+	}
+}
+
+func reloadConfig() {
+	changed, unknown, err := config.Reload()
+	for _, key := range unknown {
+		logging.Default().Warn("unknown config key", "key", key)
+	}
+	if err != nil {
+		logging.Default().Error("config reload failed, keeping the current config", "error", err)
+		return
+	}
+	if len(changed) == 0 {
+		return
+	}
+	for _, option := range changed {
+		if config.RequiresRestart(option) {
+			logging.Default().Warn("config option changed, restart to apply it", "option", option)
+		} else {
+			logging.Default().Info("config option changed", "option", option)
+		}
+	}
+	logging.Default().Info("config reloaded")
+}
+
+func reloadKeystore() {
+	added, removed, err := keystore.Load()
+	if err != nil {
+		logging.Default().Error("keystore reload failed, keeping the current keys", "error", err)
+		return
+	}
+	if added > 0 || removed > 0 {
+		logging.Default().Info("keystore reloaded", "added", added, "removed", removed)
+	}
+}
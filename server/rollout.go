@@ -0,0 +1,69 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// clientId returns the ID used to bucket a client into staged rollouts
+func clientId(c *gin.Context) string {
+	if id := c.Query("client_id"); id != "" {
+		return id
+	}
+	return c.GetHeader("Client-Id")
+}
+
+func parseRollout(value string) (int, error) {
+	rollout, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rollout percentage: %s", value)
+	}
+	if rollout < 0 || rollout > 100 {
+		return 0, fmt.Errorf("rollout percentage must be between 0 and 100")
+	}
+	return rollout, nil
+}
+
+// rolloutBucket deterministically maps a client to a bucket in range 0-99,
+// so the same client stays in or out of a release while it is ramped up
+func rolloutBucket(version, id string) int {
+	h := sha256.Sum256([]byte(version + ":" + id))
+	return int(binary.BigEndian.Uint32(h[:4]) % 100)
+}
+
+func InRollout(release VersionJson, id string) bool {
+	if release.Rollout >= 100 {
+		return true
+	}
+	if release.Rollout <= 0 || id == "" {
+		return false
+	}
+	return rolloutBucket(release.Version, id) < release.Rollout
+}
+
+// ResolveRelease returns the release which should be offered to the client,
+// falling back to the previous latest version for clients outside the rollout
+func ResolveRelease(latest VersionJson, id string) (VersionJson, bool) {
+	if InRollout(latest, id) {
+		latest.Previous = nil
+		return latest, true
+	}
+	if latest.Previous != nil {
+		return *latest.Previous, true
+	}
+	return VersionJson{}, false
+}
+
+// previousRelease returns the release clients outside of the rollout of a new
+// version should get, given the currently published latest version
+func previousRelease(current VersionJson, version string) *VersionJson {
+	if current.Version == version || current.Rollout < 100 {
+		return current.Previous
+	}
+	current.Previous = nil
+	return &current
+}
@@ -1,17 +1,22 @@
 package server
 
 import (
-	"io"
-	"log"
+	"errors"
+	"io/fs"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
+	"time"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/gin-gonic/gin"
 	"wpkg.dev/wpkgup/config"
 	"wpkg.dev/wpkgup/crypto"
 	"wpkg.dev/wpkgup/keystore"
+	"wpkg.dev/wpkgup/storage"
+	"wpkg.dev/wpkgup/tokens"
 	"wpkg.dev/wpkgup/utils"
 )
 
@@ -28,31 +33,83 @@ func NoRoute(c *gin.Context) {
 	c.JSON(http.StatusNotFound, gin.H{"code": "PAGE_NOT_FOUND", "message": "404 page not found"})
 }
 
-func Ping(c *gin.Context) {
-	c.String(http.StatusOK, "pong")
-}
-
 func Files(c *gin.Context) {
-	log.SetPrefix("[FILE SERVER] ")
-
 	path := c.Param("content")
 
 	var list []Href
 
-	file := filepath.Join(config.WorkDir, config.ContentDir, path)
+	segments, _ := ParseIdentPath(path)
+	if len(segments) == 1 && !authorizeRead(c, string(segments[0]), "") {
+		return
+	}
+	if len(segments) > 1 && !authorizeRead(c, string(segments[0]), string(segments[1])) {
+		return
+	}
+
+	// binaries and signatures of releases are kept in the blob store
+	if release, ok := blobRelease(filepath.Dir(path)); ok {
+		var blob string
+		switch {
+		case storage.Join(release.Path) == storage.Join(path):
+			blob = release.BinaryPath()
+		case release.Signature != "" && filepath.Base(path) == "signature.der":
+			blob = release.SignaturePath()
+		}
+		if blob != "" {
+			err := serveContent(c, blob, filepath.Base(path))
+			if err != nil {
+				reqLog(c).Error("sending file failed", "error", err)
+				c.JSON(500, gin.H{"error": err.Error()})
+			}
+			return
+		}
+	}
+
+	info, err := storage.Default.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		NoRoute(c)
+		return
+	} else if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
 
-	if utils.IsDir(file) {
-		files, err := os.ReadDir(file)
+	if info.IsDir {
+		viewer, _ := credentials(c)
+		files, err := storage.Default.List(path)
 		if err != nil {
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
 		for _, file := range files {
+			//hidden files like the blob store can't be requested
+			if _, err := ParseIdent(file.Name); err != nil {
+				continue
+			}
+			//private components and channels are only listed for readers
+			if len(segments) == 0 && config.Current().IsPrivate(file.Name, "") && !viewer.canRead(file.Name) {
+				continue
+			}
+			if len(segments) == 1 && config.Current().IsPrivate(string(segments[0]), file.Name) && !viewer.canRead(string(segments[0])) {
+				continue
+			}
 			list = append(list, Href{
-				Href: filepath.Clean("/" + "files" + path + "/" + file.Name()),
-				Name: file.Name(),
+				Href: filepath.Clean("/" + "files" + path + "/" + file.Name),
+				Name: file.Name,
 			})
 		}
+		if release, ok := blobRelease(path); ok {
+			list = append(list, Href{
+				Href: filepath.Clean("/" + "files" + release.Path),
+				Name: filepath.Base(release.Path),
+			})
+			if release.Signature != "" {
+				list = append(list, Href{
+					Href: filepath.Clean("/" + "files" + path + "/signature.der"),
+					Name: "signature.der",
+				})
+			}
+		}
 
 		c.Header("Content-Type", "text/html")
 		c.String(http.StatusOK, ProcessTemplate("file", FilesTemplate, gin.H{
@@ -60,51 +117,12 @@ func Files(c *gin.Context) {
 			"list": list,
 		}))
 	} else {
-		f, err := os.Open(file)
-		if err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
-			return
-		}
-		defer f.Close()
-
-		mime, err := utils.GetMimeType(file)
+		err := serveContent(c, path, info.Name)
 		if err != nil {
+			reqLog(c).Error("sending file failed", "error", err)
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
-
-		filesize, err := utils.FileSize(file)
-		if err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
-			return
-		}
-
-		c.Header("Content-Type", mime)
-		c.Header("Content-Length", strconv.Itoa(int(filesize)))
-		c.Stream(func(w io.Writer) bool {
-			buffer := make([]byte, 1024)
-
-			for {
-				n, err := f.Read(buffer)
-				if err != nil && err != io.EOF {
-					log.Println("Error while reading file:", err)
-					return false
-				}
-
-				if n > 0 {
-					if _, err := w.Write(buffer[:n]); err != nil {
-						log.Println("Error while sending data to client:", err)
-						return false
-					}
-				}
-
-				if err == io.EOF {
-					break
-				}
-			}
-
-			return false
-		})
 	}
 }
 
@@ -114,57 +132,113 @@ func GetUpdateJson(c *gin.Context) {
 	Os := c.Param("os")
 	arch := c.Param("arch")
 
-	path := filepath.Join(config.WorkDir, config.ContentDir, component, channel, Os, arch, "version.json")
+	if !authorizeRead(c, component, channel) {
+		return
+	}
 
-	if !utils.FileExists(path) {
-		c.JSON(404, gin.H{"error": "INVALID_COMPONENT"})
+	release, err := ResolveLatest(component, channel, Os, arch, c.Query("constraint"), clientId(c))
+	if err != nil {
+		c.JSON(releaseErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	buf, err := os.ReadFile(path)
+	policy, err := ReadChannelPolicy(component, channel)
 	if err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
+		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
-	json := string(buf)
-	c.Header("Content-Type", "application/json")
-	c.String(http.StatusOK, json)
+
+	current := c.Query("current")
+	var releases []VersionJson
+	if current != "" {
+		releases, err = ListReleases(component, channel, Os, arch)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	release.Mandatory = IsMandatory(release, policy, current, releases)
+	updateChecksTotal.WithLabelValues(releaseLabels(component, channel)...).Inc()
+	c.JSON(http.StatusOK, UpdateJson{
+		VersionJson:    release,
+		MinimumVersion: policy.MinimumVersion,
+	})
 }
 
 func GetBinary(c *gin.Context) {
-	log.SetPrefix("[API] ")
-
 	component := c.Param("component")
 	channel := c.Param("channel")
 	Os := c.Param("os")
 	version := c.Param("version")
 	arch := c.Param("arch")
 
+	//shared links grant access without credentials, only to what they sign
+	id := clientId(c)
+	if c.Query("signature") != "" {
+		if err := verifyShareUrl(c); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		id = c.Query("client_id")
+	} else if !authorizeRead(c, component, channel) {
+		return
+	}
+
 	var jsonMap VersionJson
 	var err error
 
-	log.Println("Requesting binary for component " + component + " | channel: " + channel + " | os: " + Os + " | arch: " + arch + " | version: " + version)
 	//Process path
 	if version == "latest" {
-		log.Println("Version is latest")
-		jsonMap, err = ReadVersionJson(filepath.Join(config.WorkDir, config.ContentDir, component, channel, Os, arch, "version.json"))
+		jsonMap, err = ResolveLatest(component, channel, Os, arch, c.Query("constraint"), id)
+		if err != nil {
+			c.JSON(releaseErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
 	} else {
-		jsonMap, err = ReadVersionJson(filepath.Join(config.WorkDir, config.ContentDir, component, channel, Os, arch, version, "version.json"))
+		jsonMap, err = ReadVersionJson(storage.Join(archDir(component, channel, Os, arch), version, "version.json"))
+		if errors.Is(err, fs.ErrNotExist) {
+			c.JSON(404, gin.H{"error": "INVALID_VERSION"})
+			return
+		}
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	binaryPath := jsonMap.BinaryPath()
+	filename := filepath.Base(jsonMap.Path)
+
+	s3Config := config.Current().Storage.S3
+	if presigner, ok := storage.Default.(storage.Presigner); ok && s3Config.PresignDownloads {
+		expiry := time.Duration(s3Config.PresignExpiry)
+		if expiry <= 0 {
+			expiry = 15 * time.Minute
+		}
+		url, err := presigner.PresignGet(binaryPath, filename, expiry)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		reqLog(c).Info("redirecting binary download to presigned URL", "resolved_version", jsonMap.Version, "blob", jsonMap.Blob)
+		downloadsTotal.WithLabelValues(releaseLabels(component, channel, jsonMap.Version)...).Inc()
+		c.Redirect(http.StatusFound, url)
+		return
 	}
 
+	reqLog(c).Info("serving binary", "resolved_version", jsonMap.Version, "blob", jsonMap.Blob)
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	err = serveContent(c, binaryPath, filename)
 	if err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
-	absWorkDir, _ := filepath.Abs(config.WorkDir)
-	binaryPath := filepath.Join(absWorkDir, config.ContentDir, jsonMap.Path)
-
-	log.Println("Binary path is:", binaryPath)
-	c.File(binaryPath)
+	downloadsTotal.WithLabelValues(releaseLabels(component, channel, jsonMap.Version)...).Inc()
 }
 
 func UploadBinary(c *gin.Context) {
-	log.SetPrefix("[API] ")
+	start := time.Now()
 
 	component := c.Param("component")
 	channel := c.Param("channel")
@@ -172,61 +246,129 @@ func UploadBinary(c *gin.Context) {
 	version := c.Param("version")
 	arch := c.Param("arch")
 
-	//Process path
-	tempSavePath, err := os.MkdirTemp("", "wpkgup2_*")
-	if err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
-		return
+	//Signed uploads may carry publisher credentials, which can be made mandatory
+	if hasCredentials(c) || config.Current().RequireUploadToken {
+		if !authorize(c, tokens.RolePublisher) {
+			return
+		}
 	}
 
-	//Process multipart form
-	form, err := c.MultipartForm()
+	//Check quota, the reserved bytes can't be taken by concurrent uploads
+	reserved, err := reserveQuota(component, channel, c.Request.ContentLength)
 	if err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
-	//Get file
-	file := form.File["file"][0]
-	sign := form.File["sign"][0]
-	log.Println("Receiving new binary for component " + component + " | channel: " + channel + " | version: " + version)
+	defer reserved.release()
+	quotaName := reserved.name
+	if reserved.remaining == 0 {
+		quotaExceeded(c, http.StatusInsufficientStorage, quotaName)
+		return
+	}
+
+	//the request is limited by the quota or the upload size, whichever is lower
+	limit := reserved.remaining
+	maxUploadSize := config.Current().Server.MaxUploadSize
+	if maxUploadSize > 0 && (limit < 0 || int64(maxUploadSize) < limit) {
+		limit = int64(maxUploadSize)
+		quotaName = ""
+	}
+	tooLarge := func() {
+		if quotaName != "" {
+			quotaExceeded(c, http.StatusRequestEntityTooLarge, quotaName)
+			return
+		}
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "UPLOAD_TOO_LARGE", "message": "Uploads are limited to " + maxUploadSize.String()})
+	}
+	if limit > 0 {
+		if c.Request.ContentLength > limit {
+			tooLarge()
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+	}
 
-	log.Println("Saving signature...")
-	signaturePath := filepath.Join(tempSavePath, "signature.der")
-	err = c.SaveUploadedFile(sign, signaturePath)
+	//Process path
+	err = os.MkdirAll(tempDir(), 0700)
 	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
+	tempSavePath, err := os.MkdirTemp(tempDir(), uploadTempPattern)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	defer os.RemoveAll(tempSavePath)
 
-	log.Println("Saving binary...")
-	binaryPath := filepath.Join(tempSavePath, file.Filename)
-	err = c.SaveUploadedFile(file, binaryPath)
+	//Process multipart form, the parts are written to the upload dir as they
+	//are received
+	reader, err := c.Request.MultipartReader()
 	if err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
-
-	allKeys, err := keystore.GetAllKeys()
+	form, err := receiveUpload(reader, tempSavePath)
 	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			tooLarge()
+			return
+		}
+		if errors.Is(err, errUploadValueTooLarge) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
 
-	verified := false
-	for _, key := range allKeys {
-		ecdsaKey, err := crypto.ParsePublicKeyFromString(key)
+	rollout := 100
+	if value := form.Values["rollout"]; value != "" {
+		rollout, err = parseRollout(value)
 		if err != nil {
-			log.Println("Error while parsing key:", err)
-			continue
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
-		verifyResult, err := crypto.VerifyFromSignFile(ecdsaKey, binaryPath, signaturePath)
+	}
+	//Get file
+	file, ok := form.Files["file"]
+	sign, signOk := form.Files["sign"]
+	if !ok || !signOk {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing file or sign in form"})
+		return
+	}
+	if _, err := ParseIdent(file.Filename); err != nil {
+		invalidParameter(c, "filename", err)
+		return
+	}
+	logger := reqLog(c).With("filename", file.Filename, "size", file.Size)
+	logger.Info("receiving binary")
+
+	signaturePath := sign.Path
+	binaryPath := file.Path
+
+	//the key id selects the key, uploads of older clients try every key
+	keys := keystore.Keys()
+	if keyId := form.Values["key_id"]; keyId != "" {
+		keys = nil
+		if key, ok := keystore.Lookup(keyId); ok {
+			keys = []keystore.Key{key}
+		} else {
+			logger.Warn("unknown key id", "key_id", keyId)
+		}
+	}
+
+	verified := false
+	for _, key := range keys {
+		verifyResult, err := crypto.VerifyFromSignFile(key.PublicKey, binaryPath, signaturePath)
 		if err != nil {
-			log.Println("Error while verifying:", err)
+			logger.Warn("signature verification error", "key_id", key.Fingerprint, "error", err)
 			continue
 		}
 
 		if verifyResult {
-			log.Println("Verified for ", key)
+			logger.Info("signature verified", "key_id", key.Fingerprint)
 			verified = true
 			break
 		}
@@ -234,84 +376,270 @@ func UploadBinary(c *gin.Context) {
 
 	if verified {
 		//save to content dir
-		savePath := filepath.Join(config.WorkDir, config.ContentDir, component, channel, Os, arch, version)
+		savePath := storage.Join(archDir(component, channel, Os, arch), version)
 
-		if err := os.MkdirAll(savePath, os.ModeSticky|os.ModePerm); err != nil {
+		//generate checksum
+		checksum, err := utils.Sha256File(binaryPath)
+		if err != nil {
+			logger.Error("checksum failed", "error", err)
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
 
-		//copy binary
-		err := utils.CopyFile(binaryPath, filepath.Join(savePath, file.Filename))
+		//store binary
+		err = PutBlob(binaryPath, checksum)
 		if err != nil {
-			log.Println("Copy binary error:", err)
+			logger.Error("storing binary failed", "error", err)
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
-		//copy signature
-		err = utils.CopyFile(signaturePath, filepath.Join(savePath, "signature.der"))
-		if err != nil {
-			log.Println("Copy signature error:", err)
-			c.JSON(500, gin.H{"error": err.Error()})
-			return
+		//store signature, so version.json switches to both at once
+		signatureChecksum, err := utils.Sha256File(signaturePath)
+		if err == nil {
+			err = PutBlob(signaturePath, signatureChecksum)
 		}
-
-		//generate checksum
-		checksum, err := utils.Sha256File(filepath.Join(tempSavePath, file.Filename))
 		if err != nil {
-			log.Println("Checksum error:", err)
+			logger.Error("storing signature failed", "error", err)
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
+		//the version directory and version.json of the target are updated
+		//by one upload at a time, the binary is already stored by checksum
+		unlock := lockTarget(component, channel, Os, arch)
+		defer unlock()
+
+		//the change of the stored bytes is added to the quota usage
+		since := time.Now()
+		before := versionUsage(component, channel, Os, arch, version)
+		defer func() {
+			addUsage(component, channel, versionUsage(component, channel, Os, arch, version)-before, since)
+		}()
+
+		//published versions are immutable
+		existing, err := ReadVersionJson(storage.Join(savePath, "version.json"))
+		overwrite := err == nil
+		if overwrite {
+			if existing.Checksum == checksum {
+				logger.Info("version is already published with the same binary")
+				c.Status(http.StatusCreated)
+				return
+			}
+			if c.GetHeader("Overwrite") != "true" {
+				c.JSON(http.StatusConflict, gin.H{"error": "VERSION_EXISTS", "message": "Version " + version + " is already published with a different binary"})
+				return
+			}
+			if !authorize(c, tokens.RoleAdmin) {
+				return
+			}
+			logger = reqLog(c).With("filename", file.Filename, "size", file.Size)
+			logger.Warn("overwriting published version")
+		}
 
+		published := time.Now().UTC()
 		jsonMap := VersionJson{
-			Version:  version,
-			Checksum: checksum,
-			Path:     "/" + component + "/" + channel + "/" + Os + "/" + arch + "/" + version + "/" + file.Filename,
+			Version:   version,
+			Checksum:  checksum,
+			Size:      file.Size,
+			Path:      "/" + component + "/" + channel + "/" + Os + "/" + arch + "/" + version + "/" + file.Filename,
+			Blob:      checksum,
+			Signature: signatureChecksum,
+			Published: &published,
+			Rollout:   rollout,
 		}
 
-		//Generate JSON
-		err = GenerateVersionJson(filepath.Join(config.WorkDir, config.ContentDir, component, channel, Os, arch, "version.json"), jsonMap)
-		if err != nil {
-			log.Println("JSON generate error:", err)
-			c.JSON(500, gin.H{"error": err.Error()})
-			return
+		latestPath := storage.Join(archDir(component, channel, Os, arch), "version.json")
+		if current, err := ReadVersionJson(latestPath); err == nil {
+			jsonMap.Previous = previousRelease(current, version)
 		}
-		//Generate JSON in version folder
-		err = GenerateVersionJson(filepath.Join(savePath, "version.json"), jsonMap)
+
+		//Generate JSON in version folder, before the latest version.json
+		//points clients to it
+		versionJson := jsonMap
+		versionJson.Previous = nil
+		err = GenerateVersionJson(storage.Join(savePath, "version.json"), versionJson)
 		if err != nil {
-			log.Println("JSON generate error:", err)
+			logger.Error("generating version.json failed", "error", err)
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
-
-		//Removing temp files
-		err = os.RemoveAll(tempSavePath)
+		//Generate JSON
+		err = GenerateVersionJson(latestPath, jsonMap)
 		if err != nil {
-			log.Println("Remove temp error:", err)
+			logger.Error("generating version.json failed", "error", err)
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
+		//the signature of a release uploaded before signatures were kept in
+		//the blob store isn't served anymore
+		if overwrite && existing.Signature == "" {
+			err = storage.Default.Delete(storage.Join(savePath, "signature.der"))
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				logger.Warn("removing old signature failed", "error", err)
+			}
+		}
 
+		logger.Info("binary published", "checksum", checksum)
+		uploadDuration.Observe(time.Since(start).Seconds())
+		uploadSize.Observe(float64(file.Size))
 		c.Status(http.StatusCreated)
 	} else {
-		log.Println("Signature verification failed, removing files...")
-		err := os.RemoveAll(tempSavePath)
-		if err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
-			return
-		} else {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Signature verification failed valid"})
-		}
+		logger.Warn("signature verification failed")
+		signatureFailuresTotal.Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Signature verification failed valid"})
+	}
+}
+
+func SetRollout(c *gin.Context) {
+	if !authorize(c, tokens.RolePublisher) {
+		return
+	}
+
+	component := c.Param("component")
+	channel := c.Param("channel")
+	Os := c.Param("os")
+	version := c.Param("version")
+	arch := c.Param("arch")
+
+	rollout, err := parseRollout(c.GetHeader("Rollout"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	unlock := lockTarget(component, channel, Os, arch)
+	defer unlock()
+
+	//older versions are still offered to clients asking with a constraint,
+	//so their rollout can be completed after a newer version was published
+	if !storage.Exists(storage.Default, storage.Join(archDir(component, channel, Os, arch), version, "version.json")) {
+		c.JSON(404, gin.H{"error": "INVALID_VERSION"})
+		return
+	}
+
+	err = UpdateRelease(component, channel, Os, arch, version, func(release *VersionJson) {
+		release.Rollout = rollout
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	reqLog(c).Info("rollout set", "rollout", rollout)
+	c.Status(http.StatusOK)
+}
+
+func SetMandatory(c *gin.Context) {
+	if !authorize(c, tokens.RolePublisher) {
+		return
 	}
+
+	component := c.Param("component")
+	channel := c.Param("channel")
+	Os := c.Param("os")
+	version := c.Param("version")
+	arch := c.Param("arch")
+
+	mandatory, err := strconv.ParseBool(c.GetHeader("Mandatory"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mandatory value"})
+		return
+	}
+
+	unlock := lockTarget(component, channel, Os, arch)
+	defer unlock()
+
+	if !storage.Exists(storage.Default, storage.Join(archDir(component, channel, Os, arch), version, "version.json")) {
+		c.JSON(404, gin.H{"error": "INVALID_VERSION"})
+		return
+	}
+
+	err = UpdateRelease(component, channel, Os, arch, version, func(release *VersionJson) {
+		release.Mandatory = mandatory
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	reqLog(c).Info("mandatory flag set", "mandatory", mandatory)
+	c.Status(http.StatusOK)
+}
+
+func SetMinimumVersion(c *gin.Context) {
+	if !authorize(c, tokens.RolePublisher) {
+		return
+	}
+
+	component := c.Param("component")
+	channel := c.Param("channel")
+	version := c.GetHeader("Version")
+
+	if !storage.IsDir(storage.Default, storage.Join(component, channel)) {
+		c.JSON(404, gin.H{"error": "INVALID_COMPONENT"})
+		return
+	}
+
+	if _, err := semver.NewVersion(version); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version: " + err.Error()})
+		return
+	}
+
+	unlock := lockTarget(component, channel)
+	defer unlock()
+
+	policy, err := ReadChannelPolicy(component, channel)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	policy.MinimumVersion = version
+
+	err = GenerateChannelJson(channelJsonPath(component, channel), policy)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	reqLog(c).Info("minimum version set", "minimum_version", version)
+	c.Status(http.StatusOK)
+}
+
+func ClearMinimumVersion(c *gin.Context) {
+	if !authorize(c, tokens.RolePublisher) {
+		return
+	}
+
+	component := c.Param("component")
+	channel := c.Param("channel")
+
+	unlock := lockTarget(component, channel)
+	defer unlock()
+
+	policy, err := ReadChannelPolicy(component, channel)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	if policy.MinimumVersion == "" {
+		c.Status(http.StatusOK)
+		return
+	}
+	policy.MinimumVersion = ""
+
+	err = GenerateChannelJson(channelJsonPath(component, channel), policy)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	reqLog(c).Info("minimum version cleared")
+	c.Status(http.StatusOK)
 }
 
 func AddPublicKey(c *gin.Context) {
-	password := c.GetHeader("Password")
 	key := c.GetHeader("Key")
 
-	if password != config.LoadedConfig.Password {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+	if !authorize(c, tokens.RoleAdmin) {
 		return
 	}
 
@@ -320,6 +648,7 @@ func AddPublicKey(c *gin.Context) {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
+	reqLog(c).Info("public key added")
 
 	c.Status(http.StatusCreated)
 }
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"wpkg.dev/wpkgup/config"
+	"wpkg.dev/wpkgup/crypto"
+	"wpkg.dev/wpkgup/keystore"
+	"wpkg.dev/wpkgup/logging"
+	"wpkg.dev/wpkgup/storage"
+)
+
+// newTestServer returns the routes of a server with a temp workdir, content
+// in memory and a private key authorized to upload
+func newTestServer(t testing.TB) (*gin.Engine, *storage.Memory, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	logger, _ := logging.New(io.Discard, logging.LevelError, "")
+	logging.SetDefault(logger)
+
+	config.WorkDir = t.TempDir()
+	config.Set(config.Config{})
+	memory := storage.NewMemory()
+	storage.Default = memory
+	usageMutex.Lock()
+	usages = map[string]*dirUsage{}
+	usageMutex.Unlock()
+
+	privateKey, publicKey, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := crypto.PublicKeyToBase64(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keystore.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := keystore.AddKey(encoded); err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	InitControllers(r)
+	return r, memory, privateKey
+}
+
+// uploadRequest returns a signed upload of content like the client sends it
+func uploadRequest(t testing.TB, privateKey *ecdsa.PrivateKey, path string, content []byte) *http.Request {
+	t.Helper()
+
+	binary := filepath.Join(t.TempDir(), "app.bin")
+	if err := os.WriteFile(binary, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	signature, err := crypto.Sign(privateKey, binary)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreateFormFile("file", "app.bin")
+	part.Write(content)
+	part, _ = writer.CreateFormFile("sign", "sign.der")
+	part.Write(signature)
+	writer.Close()
+
+	req := httptest.NewRequest("POST", path, &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"wpkg.dev/wpkgup/config"
+	"wpkg.dev/wpkgup/storage"
+	"wpkg.dev/wpkgup/tokens"
+)
+
+// DefaultShareExpiry is how long a shared download link is valid by default
+const DefaultShareExpiry = 24 * time.Hour
+
+var shareKey []byte
+
+var (
+	errShareExpired   = errors.New("SHARE_EXPIRED")
+	errShareSignature = errors.New("INVALID_SIGNATURE")
+	errShareIp        = errors.New("SHARE_IP_MISMATCH")
+)
+
+// InitShareKey loads the key signing download links, a new one is generated on
+// first start. Removing the key file invalidates all links.
+func InitShareKey() error {
+	path := filepath.Join(config.WorkDir, config.ShareKeyFile)
+	key, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return err
+		}
+		err = os.WriteFile(path, key, 0600)
+	}
+	if err != nil {
+		return err
+	}
+	if len(key) < 32 {
+		return errors.New(path + " is too short")
+	}
+	shareKey = key
+	return nil
+}
+
+// shareSignature signs path with its whole query except the signature, so
+// parameters can't be added to a shared link
+func shareSignature(path string, query url.Values) string {
+	signed := url.Values{}
+	for key, values := range query {
+		if key != "signature" {
+			signed[key] = values
+		}
+	}
+	mac := hmac.New(sha256.New, shareKey)
+	mac.Write([]byte(path + "?" + signed.Encode()))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// signShareUrl returns path with a query granting access until expires,
+// only from ip if it isn't empty
+func signShareUrl(path string, expires time.Time, ip string) string {
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	if ip != "" {
+		query.Set("ip", ip)
+	}
+	query.Set("signature", shareSignature(path, query))
+	return path + "?" + query.Encode()
+}
+
+// verifyShareUrl checks the signature query of a shared download link
+func verifyShareUrl(c *gin.Context) error {
+	query := c.Request.URL.Query()
+	expected := shareSignature(c.Request.URL.Path, query)
+	if !hmac.Equal([]byte(expected), []byte(query.Get("signature"))) {
+		return errShareSignature
+	}
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return errShareSignature
+	}
+	if time.Now().Unix() > expires {
+		return errShareExpired
+	}
+	if ip := query.Get("ip"); ip != "" && ip != c.ClientIP() {
+		return errShareIp
+	}
+	return nil
+}
+
+// ShareBinary mints a signed link to download a binary without credentials
+func ShareBinary(c *gin.Context) {
+	if !authorize(c, tokens.RolePublisher) {
+		return
+	}
+
+	component := c.Param("component")
+	channel := c.Param("channel")
+	Os := c.Param("os")
+	version := c.Param("version")
+	arch := c.Param("arch")
+
+	expiry := DefaultShareExpiry
+	if value := c.GetHeader("Expires-In"); value != "" {
+		var err error
+		expiry, err = time.ParseDuration(value)
+		if err != nil || expiry <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid expiry " + value})
+			return
+		}
+	}
+
+	ip := c.GetHeader("Bind-Ip")
+	if ip != "" && net.ParseIP(ip) == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid IP address " + ip})
+		return
+	}
+
+	if version != "latest" && !storage.Exists(storage.Default, storage.Join(archDir(component, channel, Os, arch), version, "version.json")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": errNoRelease.Error()})
+		return
+	}
+
+	expires := time.Now().Add(expiry)
+	path := "/api/" + component + "/" + channel + "/" + Os + "/" + arch + "/" + version + "/getbinary"
+
+	reqLog(c).Info("binary shared", "expires", expires.UTC(), "bind_ip", ip)
+	c.JSON(http.StatusOK, gin.H{
+		"url":     signShareUrl(path, expires, ip),
+		"expires": expires.UTC(),
+	})
+}
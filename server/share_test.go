@@ -0,0 +1,61 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSharedLinks(t *testing.T) {
+	r, _, privateKey := newTestServer(t)
+	shareKey = []byte("0123456789abcdef0123456789abcdef")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, uploadRequest(t, privateKey, "/api/app/stable/linux/amd64/1.0.0/uploadbinary", []byte("binary")))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("upload answered %d", w.Code)
+	}
+
+	path := "/api/app/stable/linux/amd64/latest/getbinary"
+	link := signShareUrl(path, time.Now().Add(time.Hour), "")
+	tests := []struct {
+		name string
+		url  string
+		want int
+	}{
+		{"signed", link, http.StatusOK},
+		{"added constraint", link + "&constraint=%3C1.0.0", http.StatusForbidden},
+		{"added client id", link + "&client_id=abc", http.StatusForbidden},
+		{"changed expiry", signShareUrl(path, time.Now().Add(time.Hour), "") + "0", http.StatusForbidden},
+		{"other path", "/api/app/stable/linux/amd64/1.0.0/getbinary" + link[len(path):], http.StatusForbidden},
+		{"bound to other ip", signShareUrl(path, time.Now().Add(time.Hour), "203.0.113.7"), http.StatusForbidden},
+		{"expired", signShareUrl(path, time.Now().Add(-time.Minute), ""), http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", test.url, nil))
+			if w.Code != test.want {
+				t.Errorf("GET %s answered %d, want %d", test.url, w.Code, test.want)
+			}
+		})
+	}
+}
+
+func TestGetMissingVersion(t *testing.T) {
+	r, _, privateKey := newTestServer(t)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, uploadRequest(t, privateKey, "/api/app/stable/linux/amd64/1.0.0/uploadbinary", []byte("binary")))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("upload answered %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/app/stable/linux/amd64/2.0.0/getbinary", nil))
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "INVALID_VERSION") || strings.Contains(w.Body.String(), "app/stable") {
+		t.Errorf("download of missing version answered %d: %s", w.Code, w.Body)
+	}
+}
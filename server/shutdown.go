@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"wpkg.dev/wpkgup/config"
+	"wpkg.dev/wpkgup/logging"
+)
+
+// DefaultShutdownTimeout is how long in-flight requests are drained on shutdown
+const DefaultShutdownTimeout = 30 * time.Second
+
+// uploadTempPattern names the temp dirs receiving uploads
+const uploadTempPattern = "upload_*"
+
+// tempDir holds the temp dirs of the server, it isn't shared with other
+// processes
+func tempDir() string {
+	return filepath.Join(config.WorkDir, config.TempDir)
+}
+
+// shutdownOnSignal stops accepting connections on SIGINT or SIGTERM and waits
+// for in-flight requests until the configured timeout, then closes the
+// remaining ones. The returned channel is closed when all servers stopped.
+func shutdownOnSignal(servers ...*http.Server) <-chan struct{} {
+	done := make(chan struct{})
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		sig := <-stop
+		signal.Stop(stop)
+
+		timeout := time.Duration(config.Current().Server.ShutdownTimeout)
+		if timeout <= 0 {
+			timeout = DefaultShutdownTimeout
+		}
+		logging.Default().Info("draining requests", "signal", sig.String(), "timeout", timeout)
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		for _, srv := range servers {
+			if err := srv.Shutdown(ctx); err != nil {
+				logging.Default().Warn("shutdown timed out, closing remaining connections", "error", err)
+				srv.Close()
+			}
+		}
+		close(done)
+	}()
+	return done
+}
+
+// removeOrphanedTempDirs removes upload temp dirs left behind by a killed
+// server
+func removeOrphanedTempDirs() {
+	entries, err := os.ReadDir(tempDir())
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logging.Default().Error("temp dir cleanup failed", "error", err)
+		return
+	}
+
+	for _, entry := range entries {
+		dir := filepath.Join(tempDir(), entry.Name())
+		if err := os.RemoveAll(dir); err != nil {
+			logging.Default().Error("temp dir cleanup failed", "error", err)
+			continue
+		}
+		logging.Default().Info("removed orphaned temp dir", "dir", dir)
+	}
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTempDirs(t *testing.T) {
+	r, _, privateKey := newTestServer(t)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, uploadRequest(t, privateKey, "/api/app/stable/linux/amd64/1.0.0/uploadbinary", []byte("binary")))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("upload answered %d", w.Code)
+	}
+	entries, err := os.ReadDir(tempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("upload left %d entries in the temp dir", len(entries))
+	}
+
+	orphan := filepath.Join(tempDir(), "upload_1")
+	if err := os.MkdirAll(orphan, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(orphan, "binary"), []byte("binary"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	removeOrphanedTempDirs()
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Errorf("orphaned temp dir wasn't removed: %v", err)
+	}
+}
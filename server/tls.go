@@ -0,0 +1,181 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"wpkg.dev/wpkgup/config"
+	"wpkg.dev/wpkgup/logging"
+)
+
+// certPollInterval is how often certificate files are checked for changes
+const certPollInterval = 30 * time.Second
+
+// certReloader serves the certificate and client CA of the config and swaps
+// them when their files change, established connections keep their state
+type certReloader struct {
+	conf config.TLSConfig
+
+	mutex    sync.RWMutex
+	cert     *tls.Certificate
+	clientCA *x509.CertPool
+	modTimes map[string]time.Time
+}
+
+func newCertReloader(conf config.TLSConfig) (*certReloader, error) {
+	reloader := &certReloader{conf: conf}
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+func (r *certReloader) files() []string {
+	files := []string{r.conf.CertFile, r.conf.KeyFile}
+	if r.conf.ClientCAFile != "" {
+		files = append(files, r.conf.ClientCAFile)
+	}
+	return files
+}
+
+func (r *certReloader) load() error {
+	modTimes := map[string]time.Time{}
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		modTimes[file] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.conf.CertFile, r.conf.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	var clientCA *x509.CertPool
+	if r.conf.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.conf.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		clientCA = x509.NewCertPool()
+		if !clientCA.AppendCertsFromPEM(pem) {
+			return errors.New("no certificates found in " + r.conf.ClientCAFile)
+		}
+	}
+
+	r.mutex.Lock()
+	r.cert = &cert
+	r.clientCA = clientCA
+	r.modTimes = modTimes
+	r.mutex.Unlock()
+	return nil
+}
+
+// changed reports whether any of the files was modified since the last load
+func (r *certReloader) changed() bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			// a file being replaced is retried on the next poll
+			continue
+		}
+		if !info.ModTime().Equal(r.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+// watch reloads the certificates on SIGHUP or when their files change, a
+// failed reload keeps the previous certificates
+func (r *certReloader) watch() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	ticker := time.NewTicker(certPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-hup:
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+		}
+
+		if err := r.load(); err != nil {
+			logging.Default().Error("certificate reload failed", "error", err)
+			continue
+		}
+		logging.Default().Info("certificates reloaded")
+	}
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.cert, nil
+}
+
+func (r *certReloader) tlsConfig() (*tls.Config, error) {
+	minVersion := uint16(tls.VersionTLS12)
+	switch r.conf.MinVersion {
+	case "", "1.2":
+	case "1.3":
+		minVersion = tls.VersionTLS13
+	default:
+		return nil, errors.New("unsupported minimum TLS version " + r.conf.MinVersion + ", expected 1.2 or 1.3")
+	}
+
+	base := &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: r.getCertificate,
+	}
+	if r.conf.ClientCAFile == "" {
+		return base, nil
+	}
+
+	clientAuth := tls.VerifyClientCertIfGiven
+	if r.conf.RequireClientCert {
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+	// the client CA pool can change, so every handshake gets a config with
+	// the current one
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		conf := base.Clone()
+		conf.GetConfigForClient = nil
+		conf.ClientAuth = clientAuth
+		r.mutex.RLock()
+		conf.ClientCAs = r.clientCA
+		r.mutex.RUnlock()
+		return conf, nil
+	}
+	return base, nil
+}
+
+// redirectHandler sends plain HTTP requests to the HTTPS port
+func redirectHandler(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		host, _, err := net.SplitHostPort(req.Host)
+		if err != nil {
+			host = req.Host
+		}
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+		http.Redirect(w, req, "https://"+host+req.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
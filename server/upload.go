@@ -0,0 +1,89 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+)
+
+// maxUploadValueSize limits the text fields of an upload, they are held in
+// memory
+const maxUploadValueSize = 1 << 10
+
+var errUploadValueTooLarge = errors.New("form value is too large")
+
+// uploadFile is a file part of an upload saved in the upload temp dir
+type uploadFile struct {
+	Filename string
+	Path     string
+	Size     int64
+}
+
+// uploadForm holds the fields of an upload, like multipart.Form only the first
+// part of a field is used
+type uploadForm struct {
+	Values map[string]string
+	Files  map[string]uploadFile
+}
+
+// receiveUpload reads the parts of an upload one at a time and saves the file
+// and sign parts below dir, named after their field. Unlike
+// Request.MultipartForm nothing is written to the system temp dir.
+func receiveUpload(reader *multipart.Reader, dir string) (uploadForm, error) {
+	form := uploadForm{Values: map[string]string{}, Files: map[string]uploadFile{}}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return form, nil
+		}
+		if err != nil {
+			return form, err
+		}
+		err = form.receivePart(part, dir)
+		part.Close()
+		if err != nil {
+			return form, err
+		}
+	}
+}
+
+func (form uploadForm) receivePart(part *multipart.Part, dir string) error {
+	name := part.FormName()
+	if part.FileName() == "" {
+		if _, ok := form.Values[name]; ok {
+			_, err := io.Copy(io.Discard, part)
+			return err
+		}
+		value, err := io.ReadAll(io.LimitReader(part, maxUploadValueSize+1))
+		if err != nil {
+			return err
+		}
+		if len(value) > maxUploadValueSize {
+			return errUploadValueTooLarge
+		}
+		form.Values[name] = string(value)
+		return nil
+	}
+
+	//the field names the saved file, so only known fields are kept
+	if _, ok := form.Files[name]; ok || (name != "file" && name != "sign") {
+		_, err := io.Copy(io.Discard, part)
+		return err
+	}
+	path := filepath.Join(dir, name)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	size, err := io.Copy(f, part)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	form.Files[name] = uploadFile{Filename: part.FileName(), Path: path, Size: size}
+	return nil
+}
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"wpkg.dev/wpkgup/config"
+	"wpkg.dev/wpkgup/crypto"
+	"wpkg.dev/wpkgup/storage"
+)
+
+// checkingBackend runs check after every write
+type checkingBackend struct {
+	storage.Backend
+	check func() error
+	errs  []error
+}
+
+func (b *checkingBackend) Put(path string, r io.Reader) error {
+	if err := b.Backend.Put(path, r); err != nil {
+		return err
+	}
+	if err := b.check(); err != nil {
+		b.errs = append(b.errs, fmt.Errorf("after writing %s: %w", path, err))
+	}
+	return nil
+}
+
+func (b *checkingBackend) Delete(path string) error {
+	if err := b.Backend.Delete(path); err != nil {
+		return err
+	}
+	if err := b.check(); err != nil {
+		b.errs = append(b.errs, fmt.Errorf("after deleting %s: %w", path, err))
+	}
+	return nil
+}
+
+// servedFile returns the body of a file of the file browser
+func servedFile(r http.Handler, path string) ([]byte, error) {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/files"+path, nil))
+	if w.Code != http.StatusOK {
+		return nil, fmt.Errorf("GET /files%s answered %d", path, w.Code)
+	}
+	return w.Body.Bytes(), nil
+}
+
+// checkServedSignature fails if the file browser serves a signature of the
+// version which doesn't verify the binary it serves
+func checkServedSignature(t testing.TB, r http.Handler, publicKey *ecdsa.PublicKey, dir string) error {
+	binary, err := servedFile(r, dir+"/app.bin")
+	if err != nil {
+		return err
+	}
+	signature, err := servedFile(r, dir+"/signature.der")
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(t.TempDir(), "app.bin")
+	if err := os.WriteFile(file, binary, 0600); err != nil {
+		return err
+	}
+	if ok, err := crypto.Verify(publicKey, file, signature); err != nil || !ok {
+		return fmt.Errorf("served signature doesn't verify the served binary %q", binary)
+	}
+	return nil
+}
+
+func TestOverwriteSwitchesAtOnce(t *testing.T) {
+	r, memory, privateKey := newTestServer(t)
+	publicKey := crypto.GeneratePublicFromPrivate(privateKey)
+	conf := config.Config{}
+	if err := conf.SetPassword("admin"); err != nil {
+		t.Fatal(err)
+	}
+	config.Set(conf)
+
+	overwrite := func(version, content string) {
+		t.Helper()
+		req := uploadRequest(t, privateKey, "/api/app/stable/linux/amd64/"+version+"/uploadbinary", []byte(content))
+		req.Header.Set("Overwrite", "true")
+		req.Header.Set("Password", "admin")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("upload of %s answered %d: %s", version, w.Code, w.Body)
+		}
+	}
+
+	overwrite("1.0.0", "old binary")
+	overwrite("2.0.0", "old binary")
+
+	// a release uploaded before signatures were kept in the blob store
+	legacyDir := storage.Join(archDir("app", "stable", "linux", "amd64"), "2.0.0")
+	legacy, err := ReadVersionJson(storage.Join(legacyDir, "version.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := storage.ReadFile(memory, legacy.SignaturePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.WriteFile(memory, storage.Join(legacyDir, "signature.der"), signature); err != nil {
+		t.Fatal(err)
+	}
+	legacy.Signature = ""
+	if err := GenerateVersionJson(storage.Join(legacyDir, "version.json"), legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, version := range []string{"1.0.0", "2.0.0"} {
+		dir := "/app/stable/linux/amd64/" + version
+		if err := checkServedSignature(t, r, publicKey, dir); err != nil {
+			t.Fatal(err)
+		}
+		checking := &checkingBackend{Backend: memory, check: func() error {
+			return checkServedSignature(t, r, publicKey, dir)
+		}}
+		storage.Default = checking
+		overwrite(version, "new binary")
+		storage.Default = memory
+		for _, err := range checking.errs {
+			t.Errorf("overwrite of %s: %v", version, err)
+		}
+
+		binary, err := servedFile(r, dir+"/app.bin")
+		if err != nil || string(binary) != "new binary" {
+			t.Errorf("%s serves %q after the overwrite: %v", version, binary, err)
+		}
+	}
+	if storage.Exists(memory, storage.Join(legacyDir, "signature.der")) {
+		t.Error("signature of the overwritten legacy release wasn't removed")
+	}
+}
+
+// TestUploadStaysInWorkDir uploads the way the client does, with the fields
+// after the files, and checks nothing is written to the system temp dir
+func TestUploadStaysInWorkDir(t *testing.T) {
+	systemTemp := t.TempDir()
+	t.Setenv("TMPDIR", systemTemp)
+	r, _, privateKey := newTestServer(t)
+	// any part of a parsed form would be buffered to disk
+	r.MaxMultipartMemory = 0
+
+	content := []byte("binary")
+	binary := filepath.Join(t.TempDir(), "app.bin")
+	if err := os.WriteFile(binary, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	signature, err := crypto.Sign(privateKey, binary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyId, err := crypto.Fingerprint(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreateFormFile("file", binary)
+	part.Write(content)
+	part, _ = writer.CreateFormFile("sign", "sign.der")
+	part.Write(signature)
+	writer.WriteField("rollout", "40")
+	writer.WriteField("key_id", keyId)
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/api/app/stable/linux/amd64/1.0.0/uploadbinary", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("upload answered %d: %s", w.Code, w.Body)
+	}
+
+	release, err := ReadVersionJson(storage.Join(archDir("app", "stable", "linux", "amd64"), "version.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if release.Rollout != 40 || path.Base(release.Path) != "app.bin" || release.Size != int64(len(content)) {
+		t.Errorf("release is %+v", release)
+	}
+	for _, dir := range []string{systemTemp, tempDir()} {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) > 0 {
+			t.Errorf("upload left %d files in %s", len(entries), dir)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"errors"
+	"io"
+)
+
+// File is a read only view of a file in a backend which supports seeking, so
+// it can be served with http.ServeContent
+type File struct {
+	backend Backend
+	path    string
+	info    FileInfo
+	offset  int64
+	reader  io.ReadCloser
+}
+
+func Open(b Backend, path string) (*File, error) {
+	info, err := b.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir {
+		return nil, errors.New("is a directory: " + path)
+	}
+	return &File{backend: b, path: path, info: info}, nil
+}
+
+func (f *File) Stat() FileInfo {
+	return f.info
+}
+
+func (f *File) Read(p []byte) (int, error) {
+	if f.offset >= f.info.Size {
+		return 0, io.EOF
+	}
+	if f.reader == nil {
+		r, err := f.backend.Get(f.path, f.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		f.reader = r
+	}
+
+	n, err := f.reader.Read(p)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.info.Size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	if offset != f.offset && f.reader != nil {
+		f.reader.Close()
+		f.reader = nil
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *File) Close() error {
+	if f.reader == nil {
+		return nil
+	}
+	return f.reader.Close()
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Local stores content in a directory on the local filesystem
+type Local struct {
+	Root string
+}
+
+func NewLocal(root string) *Local {
+	return &Local{Root: root}
+}
+
+func (l *Local) path(p string) string {
+	return filepath.Join(l.Root, filepath.FromSlash(clean(p)))
+}
+
+// Put writes to a temporary file next to the destination and renames it, so
+// readers never see partially written content
+func (l *Local) Put(path string, r io.Reader) error {
+	dest := l.path(path)
+	dir := filepath.Dir(dest)
+	if err := os.MkdirAll(dir, os.ModeSticky|os.ModePerm); err != nil {
+		return err
+	}
+
+	w, err := os.CreateTemp(dir, "."+filepath.Base(dest)+".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, r)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(w.Name(), 0664)
+	}
+	if err == nil {
+		err = os.Rename(w.Name(), dest)
+	}
+	if err != nil {
+		os.Remove(w.Name())
+		return err
+	}
+	return nil
+}
+
+func (l *Local) Get(path string, offset, length int64) (io.ReadCloser, error) {
+	f, err := os.Open(l.path(path))
+	if err != nil {
+		return nil, err
+	}
+
+	if offset > 0 {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	if length < 0 {
+		return f, nil
+	}
+	return &limitedReadCloser{Reader: io.LimitReader(f, length), Closer: f}, nil
+}
+
+func (l *Local) Stat(path string) (FileInfo, error) {
+	info, err := os.Stat(l.path(path))
+	if err != nil {
+		return FileInfo{}, err
+	}
+	return FileInfo{
+		Name:    info.Name(),
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		IsDir:   info.IsDir(),
+	}, nil
+}
+
+func (l *Local) List(path string) ([]FileInfo, error) {
+	entries, err := os.ReadDir(l.path(path))
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		list = append(list, FileInfo{
+			Name:    info.Name(),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			IsDir:   info.IsDir(),
+		})
+	}
+	return list, nil
+}
+
+func (l *Local) Delete(path string) error {
+	p := l.path(path)
+	if _, err := os.Lstat(p); err != nil {
+		return err
+	}
+	return os.RemoveAll(p)
+}
+
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory keeps content in memory, it is meant for tests and ephemeral servers
+type Memory struct {
+	mu    sync.RWMutex
+	files map[string]memoryFile
+}
+
+type memoryFile struct {
+	data    []byte
+	modTime time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{files: map[string]memoryFile{}}
+}
+
+func notExist(op, path string) error {
+	return &fs.PathError{Op: op, Path: path, Err: fs.ErrNotExist}
+}
+
+func (m *Memory) Put(p string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[clean(p)] = memoryFile{data: data, modTime: time.Now()}
+	return nil
+}
+
+func (m *Memory) Get(p string, offset, length int64) (io.ReadCloser, error) {
+	m.mu.RLock()
+	file, ok := m.files[clean(p)]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, notExist("get", p)
+	}
+
+	data := file.data
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	data = data[offset:]
+	if length >= 0 && length < int64(len(data)) {
+		data = data[:length]
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *Memory) Stat(p string) (FileInfo, error) {
+	p = clean(p)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if file, ok := m.files[p]; ok {
+		return FileInfo{Name: path.Base(p), Size: int64(len(file.data)), ModTime: file.modTime}, nil
+	}
+
+	var info FileInfo
+	found := false
+	for name, file := range m.files {
+		if p == "" || strings.HasPrefix(name, p+"/") {
+			if !found || file.modTime.After(info.ModTime) {
+				info.ModTime = file.modTime
+			}
+			found = true
+		}
+	}
+	if !found && p != "" {
+		return FileInfo{}, notExist("stat", p)
+	}
+	info.Name = path.Base("/" + p)
+	info.IsDir = true
+	return info, nil
+}
+
+func (m *Memory) List(p string) ([]FileInfo, error) {
+	p = clean(p)
+	prefix := ""
+	if p != "" {
+		prefix = p + "/"
+	}
+
+	m.mu.RLock()
+	entries := map[string]FileInfo{}
+	for name, file := range m.files {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(name, prefix)
+		if i := strings.Index(rest, "/"); i >= 0 {
+			dir := entries[rest[:i]]
+			if file.modTime.After(dir.ModTime) {
+				dir.ModTime = file.modTime
+			}
+			dir.Name = rest[:i]
+			dir.IsDir = true
+			entries[rest[:i]] = dir
+			continue
+		}
+		entries[rest] = FileInfo{Name: rest, Size: int64(len(file.data)), ModTime: file.modTime}
+	}
+	m.mu.RUnlock()
+
+	if len(entries) == 0 && p != "" {
+		return nil, notExist("list", p)
+	}
+
+	list := make([]FileInfo, 0, len(entries))
+	for _, info := range entries {
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+func (m *Memory) Delete(p string) error {
+	p = clean(p)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	found := false
+	for name := range m.files {
+		if name == p || p == "" || strings.HasPrefix(name, p+"/") {
+			delete(m.files, name)
+			found = true
+		}
+	}
+	if !found {
+		return notExist("delete", p)
+	}
+	return nil
+}
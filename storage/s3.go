@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"wpkg.dev/wpkgup/config"
+)
+
+// S3 stores content in a bucket of an S3 compatible object storage. Objects
+// are keyed by their path, directories are emulated with key prefixes.
+type S3 struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func NewS3(conf config.S3Config) (*S3, error) {
+	if conf.Endpoint == "" || conf.Bucket == "" {
+		return nil, errors.New("s3 endpoint and bucket must be set")
+	}
+
+	client, err := minio.New(conf.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(conf.AccessKey, conf.SecretKey, ""),
+		Secure: !conf.DisableSSL,
+		Region: conf.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := client.BucketExists(context.Background(), conf.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("bucket %s does not exist", conf.Bucket)
+	}
+
+	return &S3{
+		client: client,
+		bucket: conf.Bucket,
+		prefix: strings.Trim(conf.Prefix, "/"),
+	}, nil
+}
+
+func (s *S3) key(p string) string {
+	return path.Join(s.prefix, clean(p))
+}
+
+// dirKey returns the prefix of all objects below p
+func (s *S3) dirKey(p string) string {
+	key := s.key(p)
+	if key == "" {
+		return ""
+	}
+	return key + "/"
+}
+
+func (s *S3) convertError(op, p string, err error) error {
+	code := minio.ToErrorResponse(err).Code
+	if code == "NoSuchKey" || code == "NotFound" {
+		return &fs.PathError{Op: op, Path: p, Err: fs.ErrNotExist}
+	}
+	return err
+}
+
+// putPartSize limits the memory used to buffer uploads of unknown size
+const putPartSize = 16 << 20
+
+func (s *S3) Put(p string, r io.Reader) error {
+	_, err := s.client.PutObject(context.Background(), s.bucket, s.key(p), r, -1, minio.PutObjectOptions{PartSize: putPartSize})
+	return err
+}
+
+func (s *S3) Get(p string, offset, length int64) (io.ReadCloser, error) {
+	opts := minio.GetObjectOptions{}
+	if length == 0 {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	if length > 0 {
+		if err := opts.SetRange(offset, offset+length-1); err != nil {
+			return nil, err
+		}
+	} else if offset > 0 {
+		if err := opts.SetRange(offset, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	core := minio.Core{Client: s.client}
+	body, _, _, err := core.GetObject(context.Background(), s.bucket, s.key(p), opts)
+	if err != nil {
+		return nil, s.convertError("get", p, err)
+	}
+	return body, nil
+}
+
+func (s *S3) Stat(p string) (FileInfo, error) {
+	info, err := s.client.StatObject(context.Background(), s.bucket, s.key(p), minio.StatObjectOptions{})
+	if err == nil {
+		return FileInfo{
+			Name:    path.Base(info.Key),
+			Size:    info.Size,
+			ModTime: info.LastModified,
+		}, nil
+	}
+	err = s.convertError("stat", p, err)
+	if !errors.Is(err, fs.ErrNotExist) {
+		return FileInfo{}, err
+	}
+
+	// no object, check if it is a directory
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: s.dirKey(p), MaxKeys: 1}) {
+		if obj.Err != nil {
+			return FileInfo{}, obj.Err
+		}
+		return FileInfo{Name: path.Base("/" + clean(p)), IsDir: true}, nil
+	}
+	if clean(p) == "" {
+		return FileInfo{Name: "/", IsDir: true}, nil
+	}
+	return FileInfo{}, err
+}
+
+func (s *S3) List(p string) ([]FileInfo, error) {
+	prefix := s.dirKey(p)
+
+	var list []FileInfo
+	for obj := range s.client.ListObjects(context.Background(), s.bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		name := strings.TrimPrefix(obj.Key, prefix)
+		if strings.HasSuffix(name, "/") {
+			list = append(list, FileInfo{Name: strings.TrimSuffix(name, "/"), IsDir: true})
+			continue
+		}
+		list = append(list, FileInfo{Name: name, Size: obj.Size, ModTime: obj.LastModified})
+	}
+
+	if len(list) == 0 && clean(p) != "" {
+		return nil, &fs.PathError{Op: "list", Path: p, Err: fs.ErrNotExist}
+	}
+	return list, nil
+}
+
+// objects returns the keys of the object at p and of all objects below it
+func (s *S3) objects(p string) ([]string, error) {
+	var keys []string
+	if _, err := s.client.StatObject(context.Background(), s.bucket, s.key(p), minio.StatObjectOptions{}); err == nil {
+		keys = append(keys, s.key(p))
+	}
+	for obj := range s.client.ListObjects(context.Background(), s.bucket, minio.ListObjectsOptions{Prefix: s.dirKey(p), Recursive: true}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		keys = append(keys, obj.Key)
+	}
+	return keys, nil
+}
+
+func (s *S3) Delete(p string) error {
+	keys, err := s.objects(p)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return &fs.PathError{Op: "delete", Path: p, Err: fs.ErrNotExist}
+	}
+
+	for _, key := range keys {
+		err := s.client.RemoveObject(context.Background(), s.bucket, key, minio.RemoveObjectOptions{})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *S3) PresignGet(p, filename string, expiry time.Duration) (string, error) {
+	params := url.Values{}
+	if filename != "" {
+		params.Set("response-content-disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	}
+
+	u, err := s.client.PresignedGetObject(context.Background(), s.bucket, s.key(p), expiry, params)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"time"
+
+	"wpkg.dev/wpkgup/config"
+)
+
+// Default is the backend holding the content served by the server
+var Default Backend
+
+// Backend stores published content. Paths are slash separated and relative
+// to the root of the backend, errors for missing paths match fs.ErrNotExist.
+type Backend interface {
+	// Put stores the content of r at path, atomically replacing existing
+	// content once all of r has been written
+	Put(path string, r io.Reader) error
+	// Get reads length bytes of path starting at offset, a negative length
+	// reads until the end of the file
+	Get(path string, offset, length int64) (io.ReadCloser, error)
+	Stat(path string) (FileInfo, error)
+	// List returns the entries of the directory at path sorted by name
+	List(path string) ([]FileInfo, error)
+	// Delete removes the file or directory tree at path
+	Delete(path string) error
+}
+
+// Presigner is implemented by backends which can hand out URLs to download
+// content directly from the backend, filename is suggested to the client
+type Presigner interface {
+	PresignGet(path, filename string, expiry time.Duration) (string, error)
+}
+
+type FileInfo struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+	IsDir   bool
+}
+
+func Init() error {
+	switch backend := config.Current().Storage.Backend; backend {
+	case "", "local":
+		Default = NewLocal(filepath.Join(config.WorkDir, config.ContentDir))
+	case "memory":
+		Default = NewMemory()
+	case "s3":
+		s3, err := NewS3(config.Current().Storage.S3)
+		if err != nil {
+			return err
+		}
+		Default = s3
+	default:
+		return fmt.Errorf("unknown storage backend: %s", backend)
+	}
+	return nil
+}
+
+// Join joins path elements into a clean backend path
+func Join(elem ...string) string {
+	return clean(path.Join(elem...))
+}
+
+func clean(p string) string {
+	p = path.Clean("/" + p)
+	return p[1:]
+}
+
+func ReadFile(b Backend, path string) ([]byte, error) {
+	r, err := b.Get(path, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func WriteFile(b Backend, path string, data []byte) error {
+	return b.Put(path, bytes.NewReader(data))
+}
+
+func Exists(b Backend, path string) bool {
+	_, err := b.Stat(path)
+	return err == nil
+}
+
+func IsDir(b Backend, path string) bool {
+	info, err := b.Stat(path)
+	if err != nil {
+		return false
+	}
+	return info.IsDir
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"wpkg.dev/wpkgup/config"
+)
+
+func TestLocal(t *testing.T) {
+	testBackend(t, NewLocal(t.TempDir()))
+}
+
+func TestMemory(t *testing.T) {
+	testBackend(t, NewMemory())
+}
+
+// TestS3 runs against an S3 compatible server like MinIO, configured by
+// WPKGUP_TEST_S3_ENDPOINT, _BUCKET, _ACCESS_KEY, _SECRET_KEY, _REGION and
+// _DISABLE_SSL. The bucket must exist, the test only writes below a random
+// prefix and removes it afterwards.
+func TestS3(t *testing.T) {
+	endpoint := os.Getenv("WPKGUP_TEST_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("WPKGUP_TEST_S3_ENDPOINT not set")
+	}
+	disableSSL, _ := strconv.ParseBool(os.Getenv("WPKGUP_TEST_S3_DISABLE_SSL"))
+
+	s3, err := NewS3(config.S3Config{
+		Endpoint:   endpoint,
+		Region:     os.Getenv("WPKGUP_TEST_S3_REGION"),
+		Bucket:     os.Getenv("WPKGUP_TEST_S3_BUCKET"),
+		Prefix:     "wpkgup-test-" + strconv.FormatInt(time.Now().UnixNano(), 36),
+		AccessKey:  os.Getenv("WPKGUP_TEST_S3_ACCESS_KEY"),
+		SecretKey:  os.Getenv("WPKGUP_TEST_S3_SECRET_KEY"),
+		DisableSSL: disableSSL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		s3.Delete("")
+	})
+
+	testBackend(t, s3)
+
+	if err := s3.Put("presign/app.bin", strings.NewReader("binary")); err != nil {
+		t.Fatal(err)
+	}
+	url, err := s3.PresignGet("presign/app.bin", "app.bin", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "binary" {
+		t.Errorf("presigned GET = %d %q, want 200 \"binary\"", resp.StatusCode, body)
+	}
+}
+
+func testBackend(t *testing.T, b Backend) {
+	put := func(path, content string) {
+		t.Helper()
+		if err := WriteFile(b, path, []byte(content)); err != nil {
+			t.Fatalf("Put(%s): %v", path, err)
+		}
+	}
+	get := func(path string, offset, length int64) string {
+		t.Helper()
+		r, err := b.Get(path, offset, length)
+		if err != nil {
+			t.Fatalf("Get(%s, %d, %d): %v", path, offset, length, err)
+		}
+		defer r.Close()
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("Get(%s, %d, %d): %v", path, offset, length, err)
+		}
+		return string(data)
+	}
+	names := func(path string) string {
+		t.Helper()
+		list, err := b.List(path)
+		if err != nil {
+			t.Fatalf("List(%s): %v", path, err)
+		}
+		var names []string
+		for _, info := range list {
+			name := info.Name
+			if info.IsDir {
+				name += "/"
+			}
+			names = append(names, name)
+		}
+		return strings.Join(names, " ")
+	}
+	notExist := func(path string) {
+		t.Helper()
+		if _, err := b.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Stat(%s) = %v, want fs.ErrNotExist", path, err)
+		}
+	}
+
+	put("app/stable/c.txt", "hello world")
+	put("app/stable/d.txt", "x")
+	put("app/e.txt", "old")
+	put("app/e.txt", "new")
+
+	if got := get("app/stable/c.txt", 0, -1); got != "hello world" {
+		t.Errorf("Get = %q, want \"hello world\"", got)
+	}
+	if got := get("app/stable/c.txt", 6, 3); got != "wor" {
+		t.Errorf("Get range = %q, want \"wor\"", got)
+	}
+	if got := get("app/stable/c.txt", 6, -1); got != "world" {
+		t.Errorf("Get from offset = %q, want \"world\"", got)
+	}
+	if got := get("app/e.txt", 0, -1); got != "new" {
+		t.Errorf("Get of replaced file = %q, want \"new\"", got)
+	}
+	if _, err := b.Get("app/missing", 0, -1); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Get of missing file = %v, want fs.ErrNotExist", err)
+	}
+
+	info, err := b.Stat("app/stable/c.txt")
+	if err != nil || info.IsDir || info.Size != 11 || info.Name != "c.txt" {
+		t.Errorf("Stat(file) = %+v, %v", info, err)
+	}
+	info, err = b.Stat("app")
+	if err != nil || !info.IsDir {
+		t.Errorf("Stat(dir) = %+v, %v", info, err)
+	}
+	notExist("missing")
+
+	if got := names("app"); got != "e.txt stable/" {
+		t.Errorf("List(app) = %q", got)
+	}
+	if got := names("app/stable"); got != "c.txt d.txt" {
+		t.Errorf("List(app/stable) = %q", got)
+	}
+	if _, err := b.List("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("List of missing dir = %v, want fs.ErrNotExist", err)
+	}
+
+	if err := b.Delete("app/stable"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	notExist("app/stable/c.txt")
+	if got := names("app"); got != "e.txt" {
+		t.Errorf("List after Delete = %q", got)
+	}
+}
@@ -0,0 +1,190 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"wpkg.dev/wpkgup/config"
+	"wpkg.dev/wpkgup/utils"
+)
+
+var TokensPath string
+
+// mutex serializes read-modify-write cycles of the tokens file in this process
+var mutex sync.Mutex
+
+type Role string
+
+const (
+	RoleReader    Role = "reader"
+	RolePublisher Role = "publisher"
+	RoleAdmin     Role = "admin"
+)
+
+var roleLevels = map[Role]int{
+	RoleReader:    1,
+	RolePublisher: 2,
+	RoleAdmin:     3,
+}
+
+func ParseRole(s string) (Role, error) {
+	role := Role(s)
+	if _, ok := roleLevels[role]; !ok {
+		return "", fmt.Errorf("unknown role %q, expected reader, publisher or admin", s)
+	}
+	return role, nil
+}
+
+// Allows reports whether the role grants the permissions of required
+func (r Role) Allows(required Role) bool {
+	return roleLevels[r] >= roleLevels[required]
+}
+
+type Token struct {
+	Name string `json:"name"`
+	// Hash is the SHA-256 of the token, the token itself is never stored
+	Hash    string     `json:"hash"`
+	Role    Role       `json:"role"`
+	Created time.Time  `json:"created"`
+	Revoked *time.Time `json:"revoked,omitempty"`
+}
+
+type TokenList struct {
+	Tokens []Token `json:"tokens"`
+}
+
+func Init() error {
+	TokensPath = filepath.Join(config.WorkDir, config.TokensFile)
+	if !utils.FileExists(TokensPath) {
+		return saveJson(TokenList{Tokens: []Token{}}, TokensPath)
+	}
+	return nil
+}
+
+func saveJson(tokens TokenList, path string) error {
+	b, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// tokens are read by the server while the CLI changes them
+	temp := path + ".tmp"
+	err = os.WriteFile(temp, b, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp, path)
+}
+
+func readJson(path string) (TokenList, error) {
+	var tokens TokenList
+
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return tokens, err
+	}
+
+	err = json.Unmarshal(buf, &tokens)
+	if err != nil {
+		return tokens, err
+	}
+	return tokens, nil
+}
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create issues a new token and returns its secret, which is only shown once
+func Create(name string, role Role) (string, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	tokens, err := readJson(TokensPath)
+	if err != nil {
+		return "", err
+	}
+
+	for _, token := range tokens.Tokens {
+		if token.Name == name && token.Revoked == nil {
+			return "", fmt.Errorf("token %s already exists", name)
+		}
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	secret := "wpkgup_" + base64.RawURLEncoding.EncodeToString(buf)
+
+	tokens.Tokens = append(tokens.Tokens, Token{
+		Name:    name,
+		Hash:    hash(secret),
+		Role:    role,
+		Created: time.Now().UTC(),
+	})
+
+	err = saveJson(tokens, TokensPath)
+	if err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+func List() ([]Token, error) {
+	tokens, err := readJson(TokensPath)
+	if err != nil {
+		return nil, err
+	}
+	return tokens.Tokens, nil
+}
+
+func Revoke(name string) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	tokens, err := readJson(TokensPath)
+	if err != nil {
+		return err
+	}
+
+	revoked := false
+	now := time.Now().UTC()
+	for i := range tokens.Tokens {
+		if tokens.Tokens[i].Name == name && tokens.Tokens[i].Revoked == nil {
+			tokens.Tokens[i].Revoked = &now
+			revoked = true
+		}
+	}
+	if !revoked {
+		return fmt.Errorf("no active token named %s", name)
+	}
+
+	return saveJson(tokens, TokensPath)
+}
+
+// Authenticate returns the active token matching secret
+func Authenticate(secret string) (Token, bool) {
+	tokens, err := readJson(TokensPath)
+	if err != nil {
+		return Token{}, false
+	}
+
+	secretHash := []byte(hash(secret))
+	for _, token := range tokens.Tokens {
+		if token.Revoked == nil && subtle.ConstantTimeCompare([]byte(token.Hash), secretHash) == 1 {
+			return token, true
+		}
+	}
+	return Token{}, false
+}
@@ -70,6 +70,11 @@ func GetMimeType(filePath string) (string, error) {
 	return mtype.String(), err
 }
 
+func GetMimeTypeFromReader(r io.Reader) (string, error) {
+	mtype, err := mimetype.DetectReader(r)
+	return mtype.String(), err
+}
+
 func FileExists(path string) bool {
 	_, err := os.Stat(path)
 	return err == nil